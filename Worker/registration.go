@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// heartbeatInterval must stay well below the broker's heartbeat timeout.
+const heartbeatInterval = 2 * time.Second
+
+// registration keeps this worker known to the broker for as long as the process runs.
+type registration struct {
+	broker  string
+	address string
+	stop    chan bool
+	// stopOnce lets deregister be called again, as it is when the broker repeats a Quit.
+	stopOnce sync.Once
+}
+
+func (r *registration) call(method string) (stubs.HeartbeatResponse, error) {
+	res := stubs.HeartbeatResponse{}
+	client, err := rpc.Dial("tcp", r.broker)
+	if err != nil {
+		return res, err
+	}
+	defer client.Close()
+	if method == stubs.Heartbeat {
+		err = client.Call(method, stubs.WorkerInfo{Address: r.address}, &res)
+	} else {
+		err = client.Call(method, stubs.WorkerInfo{Address: r.address}, &stubs.EmptyRes{})
+	}
+	return res, err
+}
+
+// run registers with the broker and then sends heartbeats, re-registering whenever the broker has forgotten us
+// (for example because it restarted).
+func (r *registration) run() {
+	if _, err := r.call(stubs.RegisterWorker); err != nil {
+		log.Println("registering with broker:", err)
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			res, err := r.call(stubs.Heartbeat)
+			if err != nil {
+				log.Println("heartbeat:", err)
+				continue
+			}
+			if !res.Known {
+				if _, err := r.call(stubs.RegisterWorker); err != nil {
+					log.Println("registering with broker:", err)
+				}
+			}
+		}
+	}
+}
+
+func (r *registration) deregister() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		if _, err := r.call(stubs.DeregisterWorker); err != nil {
+			log.Println("deregistering from broker:", err)
+		}
+	})
+}
@@ -5,81 +5,39 @@ import (
 	"log"
 	"net"
 	"net/rpc"
+
+	"uk.ac.bris.cs/gameoflife/node"
 	"uk.ac.bris.cs/gameoflife/stubs"
 )
 
-type Node struct{}
+// Node serves the strip RPCs from node.Store plus the worker-only Quit.
+type Node struct {
+	*node.Store
+}
 
 var quitting = make(chan bool, 1)
 
-func (n *Node) GetSegment(req stubs.WorkerRequest, res *stubs.WorkerResponse) error {
-	res.Segment = calculateNextWorld(req.WholeWorld, req.Start, req.End, req.Size)
-	return nil
-}
+var membership *registration
 
 func (n *Node) Quit(_ stubs.WorkerRequest, _ *stubs.WorkerResponse) error {
-	quitting <- true
-	return nil
-}
-
-func calculateNextWorld(world [][]uint8, start, end, width int) [][]uint8 {
-	newWorld := make([][]uint8, end-start)
-	for i := 0; i < end-start; i++ {
-		newWorld[i] = make([]uint8, width)
-	}
-	for y := start; y < end; y++ {
-		for x := 0; x < width; x++ {
-			neighbors := calculateNeighbor(x, y, world, width)
-			if neighbors < 2 || neighbors > 3 {
-				newWorld[y-start][x] = 0
-			} else if neighbors == 3 {
-				newWorld[y-start][x] = 255
-			} else if neighbors == 2 && world[y][x] == 255 {
-				newWorld[y-start][x] = 255
-			} else {
-				newWorld[y-start][x] = 0
-			}
-		}
+	if membership != nil {
+		membership.deregister()
 	}
-	return newWorld
-}
-
-func calculateNeighbor(x, y int, world [][]uint8, width int) int {
-	aliveNeighbor := 0
-	for i := -1; i <= 1; i++ {
-		for j := -1; j <= 1; j++ {
-			ny, nx := y+i, x+j
-			if nx < 0 {
-				nx = width - 1
-			} else if nx == width {
-				nx = 0
-			} else {
-				nx = nx % width
-			}
-
-			if ny < 0 {
-				ny = width - 1
-			} else if ny == width {
-				ny = 0
-			} else {
-				ny = ny % width
-			}
-
-			if world[ny][nx] == 255 {
-				if !(i == 0 && j == 0) {
-					aliveNeighbor++
-				}
-			}
-		}
+	// a repeated Quit finds the worker already on its way out
+	select {
+	case quitting <- true:
+	default:
 	}
-	return aliveNeighbor
+	return nil
 }
 
 func main() {
 	serverPort := flag.String("port", "8040", "Port to Listen")
+	broker := flag.String("broker", "", "Broker address to register with (host:port)")
+	advertise := flag.String("address", "", "Address the broker should dial this worker on (defaults to 127.0.0.1:<port>)")
 	flag.Parse()
 
-	rpc.Register(&Node{})
+	rpc.Register(&Node{node.NewStore()})
 	listener, err := net.Listen("tcp", "0.0.0.0:"+*serverPort)
 	if err != nil {
 		log.Fatal("Listener error:", err)
@@ -88,5 +46,14 @@ func main() {
 	defer listener.Close()
 	go rpc.Accept(listener)
 
+	if *broker != "" {
+		address := *advertise
+		if address == "" {
+			address = "127.0.0.1:" + *serverPort
+		}
+		membership = &registration{broker: *broker, address: address, stop: make(chan bool)}
+		go membership.run()
+	}
+
 	_ = <-quitting
 }
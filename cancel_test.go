@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// stalledBroker accepts runs but never answers anything until it is told to cancel.
+type stalledBroker struct {
+	once      sync.Once
+	cancelled chan bool
+}
+
+func (b *stalledBroker) ProcessTurns(req stubs.Request, res *stubs.Response) error {
+	<-b.cancelled
+	return nil
+}
+
+func (b *stalledBroker) GetFlips(req stubs.FlipsRequest, res *stubs.FlipsResponse) error {
+	<-b.cancelled
+	res.Known, res.Done = true, true
+	return nil
+}
+
+func (b *stalledBroker) Subscribe(req stubs.SubscribeRequest, res *stubs.Progress) error {
+	<-b.cancelled
+	return nil
+}
+
+func (b *stalledBroker) CancelRun(req stubs.SessionRequest, res *stubs.EmptyRes) error {
+	b.once.Do(func() { close(b.cancelled) })
+	return nil
+}
+
+// TestRunContext tests that requests to a broker that has stalled time out, and that a game
+// whose context is done tells the broker to stop and ends without waiting for it.
+func TestRunContext(t *testing.T) {
+	broker := &stalledBroker{cancelled: make(chan bool)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Server", broker); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go server.Accept(listener)
+
+	p := gol.Params{
+		Turns:       10,
+		Threads:     4,
+		ImageWidth:  16,
+		ImageHeight: 16,
+		Server:      listener.Addr().String(),
+		Timeout:     200 * time.Millisecond,
+		Mode:        gol.Distributed,
+		OutDir:      t.TempDir(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	events := make(chan gol.Event)
+	result := make(chan error, 1)
+	go func() { result <- gol.RunContext(ctx, p, events, nil) }()
+
+	var last gol.Event
+	timedOut := false
+	finished := timeout(t, 5*time.Second, func() {
+		for event := range events {
+			switch e := event.(type) {
+			case gol.FinalTurnComplete:
+				t.Error("ERROR: a cancelled run reported a final board")
+			case gol.ErrorOccurred:
+				if e.Operation == stubs.GetFlips && errors.Is(e.Err, gol.ErrTimeout) {
+					timedOut = true
+				} else {
+					t.Errorf("ERROR: unexpected %v", e)
+				}
+			}
+			last = event
+		}
+	}, "Your program has not returned from the gol.RunContext function once its context was done")
+	if !finished {
+		return
+	}
+
+	if err := <-result; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ERROR: expected the context's error, got %v", err)
+	}
+	if !timedOut {
+		t.Error("ERROR: expected the stalled GetFlips to be reported as timing out")
+	}
+	if e, ok := last.(gol.StateChange); !ok || e.NewState != gol.Quitting {
+		t.Errorf("ERROR: expected StateChange Quitting last, got %v", last)
+	}
+	select {
+	case <-broker.cancelled:
+	default:
+		t.Error("ERROR: the broker was not told to cancel the run")
+	}
+}
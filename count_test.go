@@ -2,13 +2,18 @@ package main
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"net"
+	"net/rpc"
 	"os"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
@@ -79,6 +84,51 @@ func TestAlive(t *testing.T) {
 	}
 }
 
+// TestCountEvery tests that alive counts arrive as often as Params.CountEvery asks, for turns
+// that keep moving on, with the right count for each.
+func TestCountEvery(t *testing.T) {
+	p := gol.Params{
+		Turns:       10000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+		CountEvery:  200 * time.Millisecond,
+	}
+	alive := readAliveCounts(p.ImageWidth, p.ImageHeight)
+	events := make(chan gol.Event, 1000)
+	keyPresses := make(chan rune, 2)
+	go gol.Run(p, events, keyPresses)
+
+	counts := 0
+	lastTurn := 0
+	timer := time.After(3 * time.Second)
+	for counts < 5 {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("ERROR: only %v AliveCellsCount events received before the run ended", counts)
+			}
+			e, isCount := event.(gol.AliveCellsCount)
+			if !isCount {
+				continue
+			}
+			if e.CompletedTurns <= lastTurn {
+				t.Errorf("ERROR: count for turn %v came after the count for turn %v", e.CompletedTurns, lastTurn)
+			}
+			if expected, known := alive[e.CompletedTurns]; known && expected != e.CellsCount {
+				t.Errorf("ERROR: At turn %v expected %v alive cells, got %v instead", e.CompletedTurns, expected, e.CellsCount)
+			}
+			lastTurn = e.CompletedTurns
+			counts++
+		case <-timer:
+			t.Fatalf("ERROR: only %v AliveCellsCount events received in 3 seconds", counts)
+		}
+	}
+	keyPresses <- 'q'
+	for range events {
+	}
+}
+
 func readAliveCounts(width, height int) map[int]int {
 	f, err := os.Open("check/alive/" + fmt.Sprintf("%vx%v.csv", width, height))
 	util.Check(err)
@@ -98,3 +148,67 @@ func readAliveCounts(width, height int) map[int]int {
 	}
 	return alive
 }
+
+// unsubscribableBroker runs a game for a second, turning down every Subscribe meanwhile.
+type unsubscribableBroker struct {
+	mu         sync.Mutex
+	subscribes int
+}
+
+func (b *unsubscribableBroker) ProcessTurns(req stubs.Request, res *stubs.Response) error {
+	time.Sleep(time.Second)
+	res.Turns, res.NewWorld = req.Turns, req.OldWorld
+	return nil
+}
+
+func (b *unsubscribableBroker) GetFlips(req stubs.FlipsRequest, res *stubs.FlipsResponse) error {
+	res.Known, res.Done = true, true
+	return nil
+}
+
+func (b *unsubscribableBroker) Subscribe(req stubs.SubscribeRequest, res *stubs.Progress) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribes++
+	return errors.New("no progress to report")
+}
+
+// TestCountFailing tests that a broker that keeps failing to report progress is only reported
+// once, and is asked again, less and less often, for the rest of the run.
+func TestCountFailing(t *testing.T) {
+	broker := &unsubscribableBroker{}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Server", broker); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go server.Accept(listener)
+
+	p := gol.Params{
+		Turns:       10,
+		ImageWidth:  16,
+		ImageHeight: 16,
+		Server:      listener.Addr().String(),
+		Mode:        gol.Distributed,
+		CountEvery:  20 * time.Millisecond,
+		OutDir:      t.TempDir(),
+	}
+	_, failures, err := runImage(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Operation != stubs.Subscribe {
+		t.Errorf("ERROR: expected one ErrorOccurred for %v, got %v", stubs.Subscribe, failures)
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	// polls every 20ms would make 50 in a second; backing off from 20ms makes about 6
+	if broker.subscribes < 2 || broker.subscribes > 10 {
+		t.Errorf("ERROR: expected the broker to be asked again, less and less often, got %v polls in a second", broker.subscribes)
+	}
+}
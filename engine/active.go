@@ -0,0 +1,173 @@
+package engine
+
+// TileSize is the side of the square tiles an Activity divides a strip into. It is one packed
+// word wide.
+const TileSize = 64
+
+// Activity tracks which tiles of a strip changed on its last turn, so that stepping the strip
+// only works out the tiles that can change. A tile can only change if it, a tile next to it or
+// the halo next to it changed on the last turn: otherwise every cell it depends on is as it
+// was a turn ago, so it comes out as it did then, which is as it is now. That holds for every
+// rule, including Generations rules and rules with B0.
+//
+// The zero Activity works out every tile on its first turn. An Activity keeps to one strip
+// and one of Step and StepPacked.
+type Activity struct {
+	cols, rows int
+	// changed marks, row by row, the tiles that changed on the last turn. It is nil before the first.
+	changed []bool
+	// top and bottom are the halos the strip was last stepped with.
+	top, bottom             []uint8
+	packedTop, packedBottom []uint64
+}
+
+// Still reports whether no cell of the strip changed on its last turn.
+func (a *Activity) Still() bool {
+	if a.changed == nil {
+		return false
+	}
+	for _, changed := range a.changed {
+		if changed {
+			return false
+		}
+	}
+	return true
+}
+
+// Step is the package's Step, only working out the tiles that can have changed.
+func (a *Activity) Step(rows [][]uint8, top, bottom []uint8, width int, rule Rule, topology Topology) [][]uint8 {
+	height := len(rows)
+	a.resize(width, height)
+	dirty := a.dirty(a.haloChanges(a.top, top, width), a.haloChanges(a.bottom, bottom, width))
+	a.top, a.bottom = top, bottom
+
+	extended := make([][]uint8, 0, height+2)
+	extended = append(extended, top)
+	extended = append(extended, rows...)
+	extended = append(extended, bottom)
+
+	newWorld := make([][]uint8, height)
+	for i := 0; i < height; i++ {
+		newWorld[i] = make([]uint8, width)
+	}
+	a.eachTile(width, height, func(i, y0, y1, x0, x1 int) {
+		if dirty[i] {
+			a.changed[i] = stepCells(extended, newWorld, y0, y1, x0, x1, rule, topology)
+			return
+		}
+		a.changed[i] = false
+		for y := y0; y < y1; y++ {
+			copy(newWorld[y][x0:x1], rows[y][x0:x1])
+		}
+	})
+	return newWorld
+}
+
+// StepPacked is the package's StepPacked, only working out the tiles that can have changed.
+func (a *Activity) StepPacked(rows [][]uint64, top, bottom []uint64, width int, rule Rule, topology Topology) [][]uint64 {
+	height := len(rows)
+	words := Words(width)
+	a.resize(width, height)
+	dirty := a.dirty(a.packedHaloChanges(a.packedTop, top), a.packedHaloChanges(a.packedBottom, bottom))
+	a.packedTop, a.packedBottom = top, bottom
+
+	k := newPackedKernel(rows, top, bottom, width, rule, topology)
+	newWorld := make([][]uint64, height)
+	for y := range newWorld {
+		newWorld[y] = make([]uint64, words)
+	}
+	// a tile is one word wide, so its columns are the cells of word i%a.cols
+	a.eachTile(width, height, func(i, y0, y1, _, _ int) {
+		w := i % a.cols
+		if dirty[i] {
+			a.changed[i] = k.step(newWorld, y0, y1, w, w+1)
+			return
+		}
+		a.changed[i] = false
+		for y := y0; y < y1; y++ {
+			newWorld[y][w] = rows[y][w]
+		}
+	})
+	return newWorld
+}
+
+// resize fits the tiles to a strip of width by height cells, starting afresh if it has changed.
+func (a *Activity) resize(width, height int) {
+	cols, rows := (width+TileSize-1)/TileSize, (height+TileSize-1)/TileSize
+	if a.changed != nil && cols == a.cols && rows == a.rows {
+		return
+	}
+	*a = Activity{cols: cols, rows: rows}
+}
+
+// eachTile runs f on every tile, giving its index in changed and the rows and columns it covers.
+func (a *Activity) eachTile(width, height int, f func(i, y0, y1, x0, x1 int)) {
+	if a.changed == nil {
+		a.changed = make([]bool, a.rows*a.cols)
+	}
+	for ty := 0; ty < a.rows; ty++ {
+		y0, y1 := ty*TileSize, (ty+1)*TileSize
+		if y1 > height {
+			y1 = height
+		}
+		for tx := 0; tx < a.cols; tx++ {
+			x0, x1 := tx*TileSize, (tx+1)*TileSize
+			if x1 > width {
+				x1 = width
+			}
+			f(ty*a.cols+tx, y0, y1, x0, x1)
+		}
+	}
+}
+
+// haloChanges marks the tile columns in which a halo differs from the one before it.
+func (a *Activity) haloChanges(before, after []uint8, width int) []bool {
+	changes := make([]bool, a.cols)
+	for x := 0; x < width; x++ {
+		if before == nil || before[x] != after[x] {
+			changes[x/TileSize] = true
+		}
+	}
+	return changes
+}
+
+// packedHaloChanges is haloChanges for packed halos.
+func (a *Activity) packedHaloChanges(before, after []uint64) []bool {
+	changes := make([]bool, a.cols)
+	for w := range changes {
+		changes[w] = before == nil || before[w] != after[w]
+	}
+	return changes
+}
+
+// dirty marks the tiles that can change this turn, given the tile columns in which the halos
+// above and below the strip changed.
+func (a *Activity) dirty(topChanges, bottomChanges []bool) []bool {
+	dirty := make([]bool, a.rows*a.cols)
+	changedAt := func(ty, tx int) bool {
+		// the board may wrap round from left to right, so the end columns count as next to each other
+		tx = (tx + a.cols) % a.cols
+		switch {
+		case a.changed == nil:
+			return true
+		case ty < 0:
+			return topChanges[tx]
+		case ty >= a.rows:
+			return bottomChanges[tx]
+		}
+		return a.changed[ty*a.cols+tx]
+	}
+	for ty := 0; ty < a.rows; ty++ {
+		for tx := 0; tx < a.cols; tx++ {
+			for dy := -1; dy <= 1 && !dirty[ty*a.cols+tx]; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if changedAt(ty+dy, tx+dx) {
+						dirty[ty*a.cols+tx] = true
+						break
+					}
+				}
+			}
+		}
+	}
+	return dirty
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// sparseWorld makes a board that is dead but for a glider near the top left, a block near the
+// bottom right and a random patch, so that most tiles stay still.
+func sparseWorld(width, height int) [][]uint8 {
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = make([]uint8, width)
+	}
+	for _, cell := range [][2]int{{1, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}} {
+		world[cell[1]+3][cell[0]+3] = 255
+	}
+	for _, cell := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		world[height-4+cell[1]][width-4+cell[0]] = 255
+	}
+	patch := randomWorld(12, 12, 1)
+	for y, row := range patch {
+		copy(world[height/2+y][width/2:], row)
+	}
+	return world
+}
+
+// TestActivity tests that strips stepped by their Activity, only working out the tiles that can
+// change, come to the board Step comes to, and say whether they are still.
+func TestActivity(t *testing.T) {
+	for _, rulestring := range []string{"B3/S23", "B0/S8", "B3/S23/C8"} {
+		rule, err := ParseRule(rulestring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, topology := range []Topology{Torus, Dead, Reflect, Klein} {
+			for _, size := range [][2]int{{200, 150}, {64, 64}, {130, 70}} {
+				width, height := size[0], size[1]
+				world := sparseWorld(width, height)
+				packed := PackedSupports(rule) == nil
+				var board [][]uint64
+				if packed {
+					board = Pack(world)
+				}
+				activity := make([]Activity, 3)
+				packedActivity := make([]Activity, 3)
+				for turn := 1; turn <= 80; turn++ {
+					expected := stepStrips(world, 1, rule, topology)
+					above, below := topology.Beyond(world[0], world[height-1])
+					var packedAbove, packedBelow []uint64
+					if packed {
+						packedAbove, packedBelow = topology.BeyondPacked(board[0], board[height-1], width)
+					}
+					var got [][]uint8
+					var gotPacked [][]uint64
+					for i := range activity {
+						start, end := i*height/3, (i+1)*height/3
+						top, bottom := above, below
+						packedTop, packedBottom := packedAbove, packedBelow
+						if start > 0 {
+							top = world[start-1]
+						}
+						if end < height {
+							bottom = world[end]
+						}
+						rows := activity[i].Step(world[start:end], top, bottom, width, rule, topology)
+						if still := reflect.DeepEqual(rows, world[start:end]); activity[i].Still() != still {
+							t.Fatalf("ERROR: %v on a %vx%v %v: turn %v: strip %v reported still %v", rulestring, width, height, topology, turn, i, !still)
+						}
+						got = append(got, rows...)
+						if packed {
+							if start > 0 {
+								packedTop = board[start-1]
+							}
+							if end < height {
+								packedBottom = board[end]
+							}
+							gotPacked = append(gotPacked, packedActivity[i].StepPacked(board[start:end], packedTop, packedBottom, width, rule, topology)...)
+						}
+					}
+					if !reflect.DeepEqual(got, expected) {
+						t.Fatalf("ERROR: %v on a %vx%v %v: turn %v differs from Step", rulestring, width, height, topology, turn)
+					}
+					if packed && !reflect.DeepEqual(Unpack(gotPacked, width), expected) {
+						t.Fatalf("ERROR: %v on a %vx%v %v: packed turn %v differs from Step", rulestring, width, height, topology, turn)
+					}
+					world, board = expected, gotPacked
+				}
+			}
+		}
+	}
+}
+
+// TestActivityStill tests that a fresh Activity is not still, that one whose strip has settled
+// is, and that one moved to a strip of another size works it out afresh.
+func TestActivityStill(t *testing.T) {
+	strip := func(height int, cells ...[2]int) [][]uint8 {
+		world := make([][]uint8, height)
+		for y := range world {
+			world[y] = make([]uint8, 8)
+		}
+		for _, cell := range cells {
+			world[cell[1]][cell[0]] = 255
+		}
+		return world
+	}
+	dead := make([]uint8, 8)
+
+	var a Activity
+	if a.Still() {
+		t.Error("ERROR: expected an Activity that has not stepped yet not to be still")
+	}
+	a.Step(strip(8, [2]int{3, 3}, [2]int{4, 3}, [2]int{3, 4}, [2]int{4, 4}), dead, dead, 8, Conway, Dead)
+	if !a.Still() {
+		t.Error("ERROR: expected a block to be still")
+	}
+
+	blinker := strip(TileSize+6, [2]int{2, 3}, [2]int{3, 3}, [2]int{4, 3})
+	got := a.Step(blinker, dead, dead, 8, Conway, Dead)
+	if a.Still() {
+		t.Error("ERROR: expected a blinker to change")
+	}
+	if expected := Step(blinker, dead, dead, 8, Conway, Dead); !reflect.DeepEqual(got, expected) {
+		t.Error("ERROR: expected an Activity moved to a strip of another size to work it out afresh")
+	}
+}
+
+// TestActivitySkips tests that tiles nothing has changed next to are copied rather than worked
+// out: a lone cell slipped into a still strip behind the Activity's back would die if its tile
+// were stepped, so it only survives if the tile is skipped. A cell slipped in next to a
+// changing tile is worked out, and dies.
+func TestActivitySkips(t *testing.T) {
+	// the tile columns wrap round, so the board is wide enough for a column far from the blinker
+	const width, height = 5 * TileSize, 2 * TileSize
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = make([]uint8, width)
+	}
+	// a blinker in the top left tile keeps it and the tiles next to it busy
+	world[10][9], world[10][10], world[10][11] = 255, 255, 255
+	dead := make([]uint8, width)
+
+	var a, packed Activity
+	board := Pack(world)
+	world = a.Step(world, dead, dead, width, Conway, Dead)
+	board = packed.StepPacked(board, dead64(width), dead64(width), width, Conway, Dead)
+
+	far, near := [2]int{2*TileSize + 30, TileSize + 30}, [2]int{TileSize + 2, 10}
+	for _, cell := range [][2]int{far, near} {
+		world[cell[1]][cell[0]] = 255
+		board[cell[1]][cell[0]/64] |= 1 << uint(cell[0]%64)
+	}
+	world = a.Step(world, dead, dead, width, Conway, Dead)
+	unpacked := Unpack(packed.StepPacked(board, dead64(width), dead64(width), width, Conway, Dead), width)
+
+	for name, got := range map[string][][]uint8{"Step": world, "StepPacked": unpacked} {
+		if got[far[1]][far[0]] != 255 {
+			t.Errorf("ERROR: %v worked out a tile nothing had changed next to", name)
+		}
+		if got[near[1]][near[0]] != 0 {
+			t.Errorf("ERROR: %v skipped a tile next to one that changed", name)
+		}
+	}
+}
+
+// dead64 is a packed halo of width dead cells.
+func dead64(width int) []uint64 {
+	return make([]uint64, Words(width))
+}
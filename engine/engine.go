@@ -0,0 +1,87 @@
+// Package engine holds the Game of Life kernel shared by the workers and the broker.
+package engine
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// Step computes the next state of a strip of rows under rule. top and bottom are the rows just
+// outside the strip, supplied by whoever owns the neighbouring strips; topology decides what
+// lies beyond the left and right edges.
+func Step(rows [][]uint8, top, bottom []uint8, width int, rule Rule, topology Topology) [][]uint8 {
+	height := len(rows)
+	extended := make([][]uint8, 0, height+2)
+	extended = append(extended, top)
+	extended = append(extended, rows...)
+	extended = append(extended, bottom)
+
+	newWorld := make([][]uint8, height)
+	for i := 0; i < height; i++ {
+		newWorld[i] = make([]uint8, width)
+	}
+	stepCells(extended, newWorld, 0, height, 0, width, rule, topology)
+	return newWorld
+}
+
+// stepCells works out rows y0 to y1 and columns x0 to x1 of newWorld from extended, the strip
+// with its halos, and reports whether any of those cells changed.
+func stepCells(extended, newWorld [][]uint8, y0, y1, x0, x1 int, rule Rule, topology Topology) bool {
+	width := len(extended[0])
+	changed := false
+	for y := y0 + 1; y <= y1; y++ {
+		for x := x0; x < x1; x++ {
+			neighbors := calculateNeighbor(x, y, extended, width, topology)
+			cell := rule.NextLevel(extended[y][x], neighbors)
+			newWorld[y-1][x] = cell
+			changed = changed || cell != extended[y][x]
+		}
+	}
+	return changed
+}
+
+func calculateNeighbor(x, y int, world [][]uint8, width int, topology Topology) int {
+	aliveNeighbor := 0
+	for i := -1; i <= 1; i++ {
+		for j := -1; j <= 1; j++ {
+			ny := y + i
+			nx, ok := topology.column(x+j, width)
+			if !ok {
+				continue
+			}
+
+			if world[ny][nx] == 255 {
+				if !(i == 0 && j == 0) {
+					aliveNeighbor++
+				}
+			}
+		}
+	}
+	return aliveNeighbor
+}
+
+// CountAlive returns the number of alive cells in a set of rows.
+func CountAlive(rows [][]uint8) int {
+	count := 0
+	for _, row := range rows {
+		for _, cell := range row {
+			if cell == 255 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Diff lists the cells that differ between two versions of the same rows, along with each
+// cell's level in after. startRow is the board row the first of the rows sits at.
+func Diff(before, after [][]uint8, startRow int) ([]util.Cell, []uint8) {
+	var cells []util.Cell
+	var levels []uint8
+	for y, row := range after {
+		for x, cell := range row {
+			if cell != before[y][x] {
+				cells = append(cells, util.Cell{X: x, Y: startRow + y})
+				levels = append(levels, cell)
+			}
+		}
+	}
+	return cells, levels
+}
@@ -0,0 +1,275 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxJump is the largest k HashLife.Jump accepts, so that 2^k turns still fit in an int.
+const MaxJump = 60
+
+// maxNodes is how many squares a HashLife keeps before it forgets everything but the board.
+const maxNodes = 1 << 20
+
+// node is a square of 2^level cells on a side. Squares are shared: there is only ever one
+// node for each arrangement of cells, so equal squares are equal pointers.
+type node struct {
+	nw, ne, sw, se *node
+	level          int
+	// alive is the cell of a level 0 node.
+	alive bool
+	// pop is the number of alive cells, worked out the first time it is asked for.
+	pop      int
+	popKnown bool
+	// next holds the centre of the square advanced 2^j turns at next[j], once worked out.
+	next []*node
+}
+
+// quad identifies a node by its four quarters.
+type quad struct {
+	nw, ne, sw, se *node
+}
+
+// HashLife advances a board with Gosper's HashLife algorithm. The board is a quadtree of shared
+// squares and the future of every square is remembered, so boards that repeat themselves, or
+// are mostly empty, can be moved on by very many turns at once.
+//
+// It only handles two-state rules on a torus whose sides are the same power of two.
+type HashLife struct {
+	rule  Rule
+	size  int
+	root  *node
+	nodes map[quad]*node
+	// leaves are the dead and alive level 0 nodes, and empty the dead square of each level.
+	leaves [2]*node
+	empty  []*node
+}
+
+// HashLifeSupports reports why a board cannot be run by HashLife, or nil if it can.
+func HashLifeSupports(width, height int, rule Rule, topology Topology) error {
+	if width != height || width < 4 || width&(width-1) != 0 {
+		return fmt.Errorf("hashlife needs a square board whose side is a power of two of at least 4, not %vx%v", width, height)
+	}
+	if rule.OrDefault().States != 2 {
+		return errors.New("hashlife only runs two-state rules")
+	}
+	if topology != Torus {
+		return fmt.Errorf("hashlife only runs on a torus, not %v", topology)
+	}
+	return nil
+}
+
+// NewHashLife stores world, whose alive cells are 255, for advancing under rule.
+func NewHashLife(world [][]uint8, rule Rule, topology Topology) (*HashLife, error) {
+	size := len(world)
+	if size == 0 {
+		return nil, errors.New("hashlife needs a board")
+	}
+	if err := HashLifeSupports(len(world[0]), size, rule, topology); err != nil {
+		return nil, err
+	}
+	h := &HashLife{rule: rule.OrDefault(), size: size}
+	h.reset()
+	h.root = h.build(world, 0, 0, size)
+	return h, nil
+}
+
+// reset forgets every square.
+func (h *HashLife) reset() {
+	h.nodes = make(map[quad]*node)
+	h.leaves = [2]*node{{level: 0}, {level: 0, alive: true}}
+	h.empty = []*node{h.leaves[0]}
+}
+
+// join returns the node made of four quarters of the same level.
+func (h *HashLife) join(nw, ne, sw, se *node) *node {
+	key := quad{nw, ne, sw, se}
+	if n, ok := h.nodes[key]; ok {
+		return n
+	}
+	n := &node{nw: nw, ne: ne, sw: sw, se: se, level: nw.level + 1}
+	h.nodes[key] = n
+	return n
+}
+
+// emptyNode returns the dead square of a level.
+func (h *HashLife) emptyNode(level int) *node {
+	for len(h.empty) <= level {
+		e := h.empty[len(h.empty)-1]
+		h.empty = append(h.empty, h.join(e, e, e, e))
+	}
+	return h.empty[level]
+}
+
+// build makes the node for the size by size square of world with its top-left corner at (x, y).
+func (h *HashLife) build(world [][]uint8, x, y, size int) *node {
+	if size == 1 {
+		if world[y][x] == 255 {
+			return h.leaves[1]
+		}
+		return h.leaves[0]
+	}
+	half := size / 2
+	return h.join(
+		h.build(world, x, y, half),
+		h.build(world, x+half, y, half),
+		h.build(world, x, y+half, half),
+		h.build(world, x+half, y+half, half),
+	)
+}
+
+// fill writes the cells of n into world with its top-left corner at (x, y).
+func (h *HashLife) fill(n *node, world [][]uint8, x, y int) {
+	if n.level == 0 {
+		if n.alive {
+			world[y][x] = 255
+		}
+		return
+	}
+	if n == h.emptyNode(n.level) {
+		return
+	}
+	half := 1 << uint(n.level-1)
+	h.fill(n.nw, world, x, y)
+	h.fill(n.ne, world, x+half, y)
+	h.fill(n.sw, world, x, y+half)
+	h.fill(n.se, world, x+half, y+half)
+}
+
+// population counts the alive cells of n.
+func population(n *node) int {
+	if n.level == 0 {
+		if n.alive {
+			return 1
+		}
+		return 0
+	}
+	if !n.popKnown {
+		n.pop = population(n.nw) + population(n.ne) + population(n.sw) + population(n.se)
+		n.popKnown = true
+	}
+	return n.pop
+}
+
+// centre returns the middle square of n, half its size.
+func (h *HashLife) centre(n *node) *node {
+	return h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// base advances the middle 2x2 of a 4x4 square by one turn.
+func (h *HashLife) base(n *node) *node {
+	var cells [4][4]bool
+	for i, q := range []*node{n.nw, n.ne, n.sw, n.se} {
+		x, y := (i%2)*2, (i/2)*2
+		cells[y][x], cells[y][x+1] = q.nw.alive, q.ne.alive
+		cells[y+1][x], cells[y+1][x+1] = q.sw.alive, q.se.alive
+	}
+	next := func(x, y int) *node {
+		neighbours := 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if (dx != 0 || dy != 0) && cells[y+dy][x+dx] {
+					neighbours++
+				}
+			}
+		}
+		if h.rule.Next(cells[y][x], neighbours) {
+			return h.leaves[1]
+		}
+		return h.leaves[0]
+	}
+	return h.join(next(1, 1), next(2, 1), next(1, 2), next(2, 2))
+}
+
+// result returns the middle square of n, half its size, advanced 2^j turns. j can be at most
+// n.level-2: that is as far as the cells outside n can take to reach the middle.
+func (h *HashLife) result(n *node, j int) *node {
+	if n.next == nil {
+		n.next = make([]*node, n.level-1)
+	}
+	if r := n.next[j]; r != nil {
+		return r
+	}
+	var r *node
+	if n.level == 2 {
+		r = h.base(n)
+	} else if n == h.emptyNode(n.level) && h.rule.Birth&1 == 0 {
+		// nothing is born into empty space, so it stays empty
+		r = h.emptyNode(n.level - 1)
+	} else {
+		// nine overlapping squares of half the size, covering n
+		n00, n01, n02 := n.nw, h.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), n.ne
+		n10 := h.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne)
+		n11 := h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+		n12 := h.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne)
+		n20, n21, n22 := n.sw, h.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), n.se
+
+		// the first half of the jump happens here when the jump is as long as it can be,
+		// otherwise it all happens in the second step
+		first := func(m *node) *node {
+			if j == n.level-2 {
+				return h.result(m, j-1)
+			}
+			return h.centre(m)
+		}
+		c00, c01, c02 := first(n00), first(n01), first(n02)
+		c10, c11, c12 := first(n10), first(n11), first(n12)
+		c20, c21, c22 := first(n20), first(n21), first(n22)
+
+		second := j
+		if j == n.level-2 {
+			second = j - 1
+		}
+		r = h.join(
+			h.result(h.join(c00, c01, c10, c11), second),
+			h.result(h.join(c01, c02, c11, c12), second),
+			h.result(h.join(c10, c11, c20, c21), second),
+			h.result(h.join(c11, c12, c21, c22), second),
+		)
+	}
+	n.next[j] = r
+	return r
+}
+
+// Jump advances the board 2^k turns, for k from 0 to MaxJump.
+func (h *HashLife) Jump(k int) {
+	if k < 0 || k > MaxJump {
+		panic(fmt.Sprintf("hashlife cannot jump 2^%v turns", k))
+	}
+	// The torus is the board repeated in every direction, so a square of copies of the board
+	// four or more times its size has the board's future in the middle, aligned to the board.
+	level := 0
+	for 1<<uint(level) < h.size {
+		level++
+	}
+	tiled := h.root
+	for tiled.level < level+2 || tiled.level < k+2 {
+		tiled = h.join(tiled, tiled, tiled, tiled)
+	}
+	r := h.result(tiled, k)
+	for r.level > level {
+		r = r.nw
+	}
+	h.root = r
+
+	if len(h.nodes) > maxNodes {
+		world := h.World()
+		h.reset()
+		h.root = h.build(world, 0, 0, h.size)
+	}
+}
+
+// Alive counts the alive cells on the board.
+func (h *HashLife) Alive() int {
+	return population(h.root)
+}
+
+// World returns the board, with alive cells as 255.
+func (h *HashLife) World() [][]uint8 {
+	world := make([][]uint8, h.size)
+	for y := range world {
+		world[y] = make([]uint8, h.size)
+	}
+	h.fill(h.root, world, 0, 0)
+	return world
+}
@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestHashLife tests that jumps of 2^k turns come to the board Step comes to in as many turns,
+// under several rules.
+func TestHashLife(t *testing.T) {
+	for _, rulestring := range []string{"B3/S23", "B36/S23", "B3678/S34678"} {
+		rule, err := ParseRule(rulestring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, size := range []int{4, 16, 64} {
+			world := randomWorld(size, size, int64(size))
+			life, err := NewHashLife(world, rule, Torus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			turn := 0
+			for k := 0; k <= 6; k++ {
+				life.Jump(k)
+				for end := turn + 1<<uint(k); turn < end; turn++ {
+					world = stepBoard(world, rule)
+				}
+				if got := life.World(); !reflect.DeepEqual(got, world) {
+					t.Fatalf("ERROR: %v on %vx%v: turn %v after a jump of 2^%v differs from Step", rulestring, size, size, turn, k)
+				}
+				if alive := life.Alive(); alive != CountAlive(world) {
+					t.Fatalf("ERROR: %v on %vx%v: expected %v alive cells at turn %v, counted %v", rulestring, size, size, CountAlive(world), turn, alive)
+				}
+			}
+		}
+	}
+}
+
+func TestHashLifeSupports(t *testing.T) {
+	generations, err := ParseRule("B2/S/C3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		width, height int
+		rule          Rule
+		topology      Topology
+		supported     bool
+	}{
+		{"square", 16, 16, Conway, Torus, true},
+		{"unset rule", 64, 64, Rule{}, Torus, true},
+		{"not square", 32, 16, Conway, Torus, false},
+		{"not a power of two", 24, 24, Conway, Torus, false},
+		{"too small", 2, 2, Conway, Torus, false},
+		{"generations", 16, 16, generations, Torus, false},
+		{"dead", 16, 16, Conway, Dead, false},
+		{"klein", 16, 16, Conway, Klein, false},
+	}
+	for _, test := range tests {
+		if err := HashLifeSupports(test.width, test.height, test.rule, test.topology); (err == nil) != test.supported {
+			t.Errorf("ERROR: %v: expected supported %v, got %v", test.name, test.supported, err)
+		}
+	}
+}
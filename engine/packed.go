@@ -0,0 +1,274 @@
+package engine
+
+import (
+	"errors"
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Packed rows hold 64 cells in each uint64: cell x is bit x%64 of word x/64, set when the cell
+// is alive. Bits past the end of the row are always clear. Packed rows only have room for
+// two-state rules, and the packed kernel works out the cells of a whole word at once.
+
+// PackedSupports reports why a rule cannot be run on packed rows, or nil if it can.
+func PackedSupports(rule Rule) error {
+	if rule.OrDefault().States != 2 {
+		return errors.New("packed boards only run two-state rules")
+	}
+	return nil
+}
+
+// Words returns how many uint64s a packed row of width cells takes.
+func Words(width int) int {
+	return (width + 63) / 64
+}
+
+// PackRow packs a row whose alive cells are 255.
+func PackRow(row []uint8) []uint64 {
+	packed := make([]uint64, Words(len(row)))
+	for x, cell := range row {
+		if cell == 255 {
+			packed[x/64] |= 1 << uint(x%64)
+		}
+	}
+	return packed
+}
+
+// Pack packs every row of a board or strip.
+func Pack(rows [][]uint8) [][]uint64 {
+	packed := make([][]uint64, len(rows))
+	for y, row := range rows {
+		packed[y] = PackRow(row)
+	}
+	return packed
+}
+
+// UnpackRow turns a packed row of width cells back into a row whose alive cells are 255.
+func UnpackRow(row []uint64, width int) []uint8 {
+	unpacked := make([]uint8, width)
+	for x := range unpacked {
+		if row[x/64]>>uint(x%64)&1 == 1 {
+			unpacked[x] = 255
+		}
+	}
+	return unpacked
+}
+
+// Unpack turns packed rows of width cells back into rows whose alive cells are 255.
+func Unpack(rows [][]uint64, width int) [][]uint8 {
+	unpacked := make([][]uint8, len(rows))
+	for y, row := range rows {
+		unpacked[y] = UnpackRow(row, width)
+	}
+	return unpacked
+}
+
+// BeyondPacked is Beyond for packed rows of width cells.
+func (t Topology) BeyondPacked(first, last []uint64, width int) (above, below []uint64) {
+	switch t {
+	case Dead:
+		return make([]uint64, len(first)), make([]uint64, len(last))
+	case Reflect:
+		return first, last
+	case Klein:
+		return reversedPacked(last, width), reversedPacked(first, width)
+	default:
+		return last, first
+	}
+}
+
+// reversedPacked flips a packed row of width cells left-to-right.
+func reversedPacked(row []uint64, width int) []uint64 {
+	n := len(row)
+	r := make([]uint64, n)
+	for i, word := range row {
+		r[n-1-i] = bits.Reverse64(word)
+	}
+	// the row now ends where the last word ends, so move it back to the start
+	pad := uint(n*64 - width)
+	if pad == 0 {
+		return r
+	}
+	for i := range r {
+		r[i] >>= pad
+		if i+1 < n {
+			r[i] |= r[i+1] << (64 - pad)
+		}
+	}
+	return r
+}
+
+// StepPacked is Step for packed rows of width cells. rule must be a two-state rule.
+func StepPacked(rows [][]uint64, top, bottom []uint64, width int, rule Rule, topology Topology) [][]uint64 {
+	height := len(rows)
+	words := Words(width)
+	k := newPackedKernel(rows, top, bottom, width, rule, topology)
+	newWorld := make([][]uint64, height)
+	for y := range newWorld {
+		newWorld[y] = make([]uint64, words)
+	}
+	k.step(newWorld, 0, height, 0, words)
+	return newWorld
+}
+
+// packedKernel works out packed rows a block of words at a time.
+type packedKernel struct {
+	extended [][]uint64
+	width    int
+	topology Topology
+	// west[y] has each cell's left neighbour in the cell's own bit, and east[y] its right
+	// neighbour. Each is worked out the first time a row is stepped next to it.
+	west, east [][]uint64
+	// born and survives are the neighbour counts that lead to an alive cell, for dead and alive cells in turn
+	born, survives [9]bool
+	// last masks off the bits past the end of the row in the last word
+	last uint64
+}
+
+func newPackedKernel(rows [][]uint64, top, bottom []uint64, width int, rule Rule, topology Topology) *packedKernel {
+	k := &packedKernel{width: width, topology: topology}
+	k.extended = make([][]uint64, 0, len(rows)+2)
+	k.extended = append(k.extended, top)
+	k.extended = append(k.extended, rows...)
+	k.extended = append(k.extended, bottom)
+	k.west = make([][]uint64, len(k.extended))
+	k.east = make([][]uint64, len(k.extended))
+	for n := range k.born {
+		k.born[n] = rule.Birth>>uint(n)&1 == 1
+		k.survives[n] = rule.Survival>>uint(n)&1 == 1
+	}
+	k.last = ^uint64(0) >> uint(Words(width)*64-width)
+	return k
+}
+
+// step works out rows y0 to y1 and words w0 to w1 of newWorld, and reports whether any of
+// those cells changed.
+func (k *packedKernel) step(newWorld [][]uint64, y0, y1, w0, w1 int) bool {
+	for y := y0; y <= y1+1; y++ {
+		if k.west[y] == nil {
+			k.west[y], k.east[y] = shifted(k.extended[y], k.width, k.topology)
+		}
+	}
+	words := Words(k.width)
+	changed := false
+	for y := y0 + 1; y <= y1; y++ {
+		for w := w0; w < w1; w++ {
+			centre := k.extended[y][w]
+			count := countNeighbours(
+				k.west[y-1][w], k.extended[y-1][w], k.east[y-1][w],
+				k.west[y][w], k.east[y][w],
+				k.west[y+1][w], k.extended[y+1][w], k.east[y+1][w],
+			)
+			var alive uint64
+			for n := range k.born {
+				if !k.born[n] && !k.survives[n] {
+					continue
+				}
+				matches := count.equals(n)
+				if k.born[n] {
+					alive |= matches &^ centre
+				}
+				if k.survives[n] {
+					alive |= matches & centre
+				}
+			}
+			if w == words-1 {
+				alive &= k.last
+			}
+			newWorld[y-1][w] = alive
+			changed = changed || alive != centre
+		}
+	}
+	return changed
+}
+
+// shifted returns a packed row moved one cell right and one cell left, so that each cell's bit
+// holds its left and right neighbour. topology decides what comes in at the edges.
+func shifted(row []uint64, width int, topology Topology) (west, east []uint64) {
+	words := len(row)
+	west = make([]uint64, words)
+	east = make([]uint64, words)
+	for w := 0; w < words; w++ {
+		west[w] = row[w] << 1
+		if w > 0 {
+			west[w] |= row[w-1] >> 63
+		}
+		east[w] = row[w] >> 1
+		if w+1 < words {
+			east[w] |= row[w+1] << 63
+		}
+	}
+	if x, ok := topology.column(-1, width); ok {
+		west[0] |= row[x/64] >> uint(x%64) & 1
+	}
+	if x, ok := topology.column(width, width); ok {
+		east[words-1] |= (row[x/64] >> uint(x%64) & 1) << uint((width-1)%64)
+	}
+	return west, east
+}
+
+// counts holds a neighbour count from 0 to 8 for each of 64 cells as four bit planes.
+type counts [4]uint64
+
+// countNeighbours adds up eight neighbour words with bitwise adders.
+func countNeighbours(a, b, c, d, e, f, g, h uint64) counts {
+	s1, c1 := fullAdd(a, b, c)
+	s2, c2 := fullAdd(d, e, f)
+	s3, c3 := g^h, g&h
+	ones, c4 := fullAdd(s1, s2, s3)
+	t, ct := fullAdd(c1, c2, c3)
+	twos, cu := t^c4, t&c4
+	return counts{ones, twos, ct ^ cu, ct & cu}
+}
+
+func fullAdd(a, b, c uint64) (sum, carry uint64) {
+	ab := a ^ b
+	return ab ^ c, a&b | c&ab
+}
+
+// equals returns the cells whose count is n.
+func (k counts) equals(n int) uint64 {
+	matches := ^uint64(0)
+	for i, plane := range k {
+		if n>>uint(i)&1 == 1 {
+			matches &= plane
+		} else {
+			matches &^= plane
+		}
+	}
+	return matches
+}
+
+// CountAlivePacked returns the number of alive cells in a set of packed rows.
+func CountAlivePacked(rows [][]uint64) int {
+	count := 0
+	for _, row := range rows {
+		for _, word := range row {
+			count += bits.OnesCount64(word)
+		}
+	}
+	return count
+}
+
+// DiffPacked is Diff for packed rows, with every changed cell's level 0 or 255.
+func DiffPacked(before, after [][]uint64, startRow int) ([]util.Cell, []uint8) {
+	var cells []util.Cell
+	var levels []uint8
+	for y, row := range after {
+		for w, word := range row {
+			changed := word ^ before[y][w]
+			for changed != 0 {
+				b := bits.TrailingZeros64(changed)
+				changed &= changed - 1
+				cells = append(cells, util.Cell{X: w*64 + b, Y: startRow + y})
+				if word>>uint(b)&1 == 1 {
+					levels = append(levels, 255)
+				} else {
+					levels = append(levels, 0)
+				}
+			}
+		}
+	}
+	return cells, levels
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// packedWidths are board widths either side of the word boundaries.
+var packedWidths = []int{1, 3, 63, 64, 65, 127, 130}
+
+// TestStepPacked tests that stepping packed strips, with packed halos from their neighbours,
+// comes to the board Step comes to, on every topology and under several rules.
+func TestStepPacked(t *testing.T) {
+	for _, rulestring := range []string{"B3/S23", "B36/S23", "B0/S8", "B012345678/S"} {
+		rule, err := ParseRule(rulestring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, topology := range []Topology{Torus, Dead, Reflect, Klein} {
+			for _, width := range packedWidths {
+				world := randomWorld(width, 9, int64(width))
+				for turn := 1; turn <= 10; turn++ {
+					expected := stepStrips(world, 1, rule, topology)
+					if got := Unpack(stepPackedStrips(Pack(world), width, 3, rule, topology), width); !reflect.DeepEqual(got, expected) {
+						t.Fatalf("ERROR: %v on a %vx9 %v: turn %v differs from Step", rulestring, width, topology, turn)
+					}
+					world = expected
+				}
+			}
+		}
+	}
+}
+
+// stepPackedStrips is stepStrips for a packed board.
+func stepPackedStrips(board [][]uint64, width, strips int, rule Rule, topology Topology) [][]uint64 {
+	height := len(board)
+	above, below := topology.BeyondPacked(board[0], board[height-1], width)
+	var next [][]uint64
+	for i := 0; i < strips; i++ {
+		start, end := i*height/strips, (i+1)*height/strips
+		top, bottom := above, below
+		if start > 0 {
+			top = board[start-1]
+		}
+		if end < height {
+			bottom = board[end]
+		}
+		next = append(next, StepPacked(board[start:end], top, bottom, width, rule, topology)...)
+	}
+	return next
+}
+
+// TestPack tests that packing keeps every cell and clears the bits past the end of each row,
+// and that packed rows are reversed, counted and compared as the rows they hold.
+func TestPack(t *testing.T) {
+	for _, width := range packedWidths {
+		world := randomWorld(width, 4, int64(width))
+		packed := Pack(world)
+		if got := Unpack(packed, width); !reflect.DeepEqual(got, world) {
+			t.Errorf("ERROR: %v wide: unpacking does not give back the packed rows", width)
+		}
+		for y, row := range packed {
+			if len(row) != Words(width) {
+				t.Fatalf("ERROR: %v wide: expected %v words in a row, got %v", width, Words(width), len(row))
+			}
+			if width%64 != 0 && row[len(row)-1]>>uint(width%64) != 0 {
+				t.Errorf("ERROR: %v wide: row %v has bits set past its end", width, y)
+			}
+			if got := UnpackRow(reversedPacked(row, width), width); !reflect.DeepEqual(got, reversed(world[y])) {
+				t.Errorf("ERROR: %v wide: row %v reversed packed differs from reversed", width, y)
+			}
+		}
+		if CountAlivePacked(packed) != CountAlive(world) {
+			t.Errorf("ERROR: %v wide: expected %v alive cells, counted %v", width, CountAlive(world), CountAlivePacked(packed))
+		}
+
+		after := randomWorld(width, 4, int64(width)+1)
+		cells, levels := DiffPacked(packed, Pack(after), 7)
+		expectedCells, expectedLevels := Diff(world, after, 7)
+		if !reflect.DeepEqual(cells, expectedCells) || !reflect.DeepEqual(levels, expectedLevels) {
+			t.Errorf("ERROR: %v wide: the packed diff differs from the diff of the rows", width)
+		}
+	}
+}
+
+func TestPackedSupports(t *testing.T) {
+	generations, err := ParseRule("B2/S/C3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		rule      Rule
+		supported bool
+	}{
+		{Conway, true},
+		{Rule{}, true},
+		{Rule{Birth: 1, States: 2}, true},
+		{generations, false},
+	} {
+		if err := PackedSupports(test.rule); (err == nil) != test.supported {
+			t.Errorf("ERROR: %v: expected supported %v, got %v", test.rule, test.supported, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule is a Life-like rule: which neighbour counts give birth to a dead cell and which
+// keep an alive cell alive. Bit n of Birth or Survival stands for n alive neighbours.
+//
+// States is 2 for ordinary rules. Generations rules have more: an alive cell that does not
+// survive passes through States-2 dying states before it is dead, and dying cells neither
+// count as neighbours nor can be born into.
+//
+// Boards store each cell as a grey level rather than a state number: dead is 0, alive is 255
+// and the dying states are spread evenly in between, so images and the GUI can show them directly.
+type Rule struct {
+	Birth    uint16
+	Survival uint16
+	States   int
+}
+
+// Conway is B3/S23, used whenever a Rule is left unset.
+var Conway = Rule{Birth: 1 << 3, Survival: 1<<2 | 1<<3, States: 2}
+
+// MaxStates keeps every state of a Generations rule on its own grey level.
+const MaxStates = 256
+
+// ParseRule reads a rulestring in B/S notation (B36/S23) or the older S/B notation (23/36).
+// Generations rules add the number of states as a third part: B2/S/C3 or 345/2/4.
+func ParseRule(rulestring string) (Rule, error) {
+	rule := Rule{States: 2}
+	parts := strings.Split(strings.ToUpper(strings.TrimSpace(rulestring)), "/")
+	if len(parts) == 3 {
+		states, err := strconv.Atoi(strings.TrimPrefix(parts[2], "C"))
+		if err != nil || states < 2 || states > MaxStates {
+			return rule, fmt.Errorf("invalid rule %q: number of states must be 2-%v", rulestring, MaxStates)
+		}
+		rule.States = states
+		parts = parts[:2]
+	}
+	if len(parts) != 2 {
+		return rule, fmt.Errorf("invalid rule %q: expected B.../S...", rulestring)
+	}
+
+	first, second := parts[0], parts[1]
+	var birth, survival string
+	switch {
+	case strings.HasPrefix(first, "B") && strings.HasPrefix(second, "S"):
+		birth, survival = first[1:], second[1:]
+	case strings.HasPrefix(first, "S") && strings.HasPrefix(second, "B"):
+		birth, survival = second[1:], first[1:]
+	case !strings.ContainsAny(first+second, "BS"):
+		// S/B notation lists survival first
+		birth, survival = second, first
+	default:
+		return rule, fmt.Errorf("invalid rule %q: expected B.../S...", rulestring)
+	}
+
+	var err error
+	if rule.Birth, err = parseCounts(birth); err != nil {
+		return rule, fmt.Errorf("invalid rule %q: %w", rulestring, err)
+	}
+	if rule.Survival, err = parseCounts(survival); err != nil {
+		return rule, fmt.Errorf("invalid rule %q: %w", rulestring, err)
+	}
+	return rule, nil
+}
+
+func parseCounts(digits string) (uint16, error) {
+	var counts uint16
+	for _, d := range digits {
+		if d < '0' || d > '8' {
+			return 0, fmt.Errorf("neighbour count %q out of range 0-8", d)
+		}
+		counts |= 1 << uint(d-'0')
+	}
+	return counts, nil
+}
+
+func countsString(counts uint16) string {
+	var b strings.Builder
+	for n := 0; n <= 8; n++ {
+		if counts&(1<<uint(n)) != 0 {
+			b.WriteByte(byte('0' + n))
+		}
+	}
+	return b.String()
+}
+
+// OrDefault returns Conway for an unset Rule and the rule itself otherwise.
+func (r Rule) OrDefault() Rule {
+	if r.States == 0 {
+		return Conway
+	}
+	return r
+}
+
+// Next reports whether a cell is alive next turn.
+func (r Rule) Next(alive bool, neighbours int) bool {
+	if alive {
+		return r.Survival&(1<<uint(neighbours)) != 0
+	}
+	return r.Birth&(1<<uint(neighbours)) != 0
+}
+
+// Level is the grey level a state is stored as: 0 for dead, 255 for alive.
+func (r Rule) Level(state int) uint8 {
+	r = r.OrDefault()
+	switch {
+	case state <= 0 || state >= r.States:
+		return 0
+	case state == 1:
+		return 255
+	default:
+		return uint8(255 - (state-1)*255/(r.States-1))
+	}
+}
+
+// State maps a grey level back to the nearest state. Under a two-state rule anything but 255 is dead.
+func (r Rule) State(level uint8) int {
+	r = r.OrDefault()
+	switch {
+	case level == 255:
+		return 1
+	case level == 0 || r.States == 2:
+		return 0
+	}
+	state := 1 + (int(255-level)*(r.States-1)+127)/255
+	if state < 2 {
+		state = 2
+	} else if state > r.States-1 {
+		state = r.States - 1
+	}
+	// Level rounds down, so the state worked out above can be one off the one whose level is nearest
+	distance := func(state int) int {
+		d := int(r.Level(state)) - int(level)
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	for _, s := range []int{state - 1, state + 1} {
+		if s >= 2 && s <= r.States-1 && distance(s) < distance(state) {
+			state = s
+		}
+	}
+	return state
+}
+
+// NextLevel returns the grey level a cell stored as level has next turn.
+func (r Rule) NextLevel(level uint8, neighbours int) uint8 {
+	switch level {
+	case 0:
+		if r.Next(false, neighbours) {
+			return 255
+		}
+		return 0
+	case 255:
+		if r.Next(true, neighbours) {
+			return 255
+		}
+		return r.Level(2)
+	default:
+		return r.Level(r.State(level) + 1)
+	}
+}
+
+func (r Rule) String() string {
+	r = r.OrDefault()
+	rulestring := "B" + countsString(r.Birth) + "/S" + countsString(r.Survival)
+	if r.States > 2 {
+		rulestring += "/C" + strconv.Itoa(r.States)
+	}
+	return rulestring
+}
+
+// Set lets a Rule be used directly as a command-line flag.
+func (r *Rule) Set(rulestring string) error {
+	rule, err := ParseRule(rulestring)
+	if err != nil {
+		return err
+	}
+	*r = rule
+	return nil
+}
@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// stepBoard steps a whole board once on a torus.
+func stepBoard(world [][]uint8, rule Rule) [][]uint8 {
+	return Step(world, world[len(world)-1], world[0], len(world[0]), rule, Torus)
+}
+
+// TestBriansBrain tests the decay sequence of B2/S/C3: a pair of alive cells gives birth to
+// the cells either side of it and starts dying, and a turn later is dead while its children
+// carry on.
+func TestBriansBrain(t *testing.T) {
+	rule, err := ParseRule("B2/S/C3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		o = 0
+		A = 255
+		d = 128
+	)
+	if level := rule.Level(2); level != d {
+		t.Fatalf("ERROR: expected the dying state of B2/S/C3 stored as %v, got %v", d, level)
+	}
+	boards := [][][]uint8{
+		{
+			{o, o, o, o, o, o},
+			{o, o, o, o, o, o},
+			{o, o, A, A, o, o},
+			{o, o, o, o, o, o},
+			{o, o, o, o, o, o},
+			{o, o, o, o, o, o},
+		},
+		{
+			{o, o, o, o, o, o},
+			{o, o, A, A, o, o},
+			{o, o, d, d, o, o},
+			{o, o, A, A, o, o},
+			{o, o, o, o, o, o},
+			{o, o, o, o, o, o},
+		},
+		{
+			{o, o, A, A, o, o},
+			{o, o, d, d, o, o},
+			{o, A, o, o, A, o},
+			{o, o, d, d, o, o},
+			{o, o, A, A, o, o},
+			{o, o, o, o, o, o},
+		},
+	}
+	for turn := 1; turn < len(boards); turn++ {
+		if got := stepBoard(boards[turn-1], rule); !reflect.DeepEqual(got, boards[turn]) {
+			t.Errorf("ERROR: turn %v: expected %v, got %v", turn, boards[turn], got)
+		}
+	}
+}
+
+// referenceGenerations steps a board of states, rather than levels, under a Generations rule on a torus.
+func referenceGenerations(states [][]int, rule Rule) [][]int {
+	height, width := len(states), len(states[0])
+	next := make([][]int, height)
+	for y := range next {
+		next[y] = make([]int, width)
+		for x := range next[y] {
+			neighbours := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && states[(y+dy+height)%height][(x+dx+width)%width] == 1 {
+						neighbours++
+					}
+				}
+			}
+			switch state := states[y][x]; {
+			case state == 0 && rule.Birth>>uint(neighbours)&1 == 1:
+				next[y][x] = 1
+			case state == 0:
+				next[y][x] = 0
+			case state == 1 && rule.Survival>>uint(neighbours)&1 == 1:
+				next[y][x] = 1
+			case state+1 < rule.States:
+				next[y][x] = state + 1
+			}
+		}
+	}
+	return next
+}
+
+// TestGenerations tests Step on Generations rules against stepping the states themselves.
+func TestGenerations(t *testing.T) {
+	for _, rulestring := range []string{"B3/S23/C8", "B2/S/C3", "B34/S2345/C25", "B3/S23/C256"} {
+		t.Run(rulestring, func(t *testing.T) {
+			rule, err := ParseRule(rulestring)
+			if err != nil {
+				t.Fatal(err)
+			}
+			random := rand.New(rand.NewSource(1))
+			states := make([][]int, 24)
+			for y := range states {
+				states[y] = make([]int, 20)
+				for x := range states[y] {
+					states[y][x] = random.Intn(rule.States)
+				}
+			}
+			levels := func(states [][]int) [][]uint8 {
+				world := make([][]uint8, len(states))
+				for y, row := range states {
+					world[y] = make([]uint8, len(row))
+					for x, state := range row {
+						world[y][x] = rule.Level(state)
+					}
+				}
+				return world
+			}
+
+			world := levels(states)
+			for turn := 1; turn <= 30; turn++ {
+				states = referenceGenerations(states, rule)
+				world = stepBoard(world, rule)
+				if !reflect.DeepEqual(world, levels(states)) {
+					t.Fatalf("ERROR: turn %v differs from stepping the states", turn)
+				}
+			}
+		})
+	}
+}
+
+// TestLevels tests that every state has a level of its own that maps back to it, and that
+// levels between them round to the nearest dying state.
+func TestLevels(t *testing.T) {
+	for states := 2; states <= MaxStates; states++ {
+		rule := Rule{States: states}
+		seen := make(map[uint8]int)
+		for state := 0; state < states; state++ {
+			level := rule.Level(state)
+			if other, ok := seen[level]; ok {
+				t.Fatalf("ERROR: C%v stores states %v and %v both as %v", states, other, state, level)
+			}
+			seen[level] = state
+			if back := rule.State(level); back != state {
+				t.Fatalf("ERROR: C%v stores state %v as %v, which maps back to %v", states, state, level, back)
+			}
+		}
+	}
+
+	tests := []struct {
+		states int
+		level  uint8
+		state  int
+	}{
+		{2, 128, 0},
+		{2, 254, 0},
+		{3, 254, 2},
+		{3, 1, 2},
+		{8, 250, 2},
+		{8, 200, 3},
+		{8, 150, 4},
+		{8, 40, 7},
+		{8, 1, 7},
+	}
+	for _, test := range tests {
+		if state := (Rule{States: test.states}).State(test.level); state != test.state {
+			t.Errorf("ERROR: expected level %v to be state %v under C%v, got %v", test.level, test.state, test.states, state)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rulestring string
+		rule       Rule
+		failed     bool
+	}{
+		{rulestring: "B3/S23", rule: Conway},
+		{rulestring: "23/3", rule: Conway},
+		{rulestring: "s23/b3", rule: Conway},
+		{rulestring: "B36/S23", rule: Rule{Birth: 1<<3 | 1<<6, Survival: 1<<2 | 1<<3, States: 2}},
+		{rulestring: "B/S", rule: Rule{States: 2}},
+		{rulestring: "B2/S/C3", rule: Rule{Birth: 1 << 2, States: 3}},
+		{rulestring: "345/2/4", rule: Rule{Birth: 1 << 2, Survival: 1<<3 | 1<<4 | 1<<5, States: 4}},
+		{rulestring: "B3/S23/C1", failed: true},
+		{rulestring: "B3/S23/C257", failed: true},
+		{rulestring: "B9/S23", failed: true},
+		{rulestring: "B3", failed: true},
+		{rulestring: "B3/B23", failed: true},
+	}
+	for _, test := range tests {
+		rule, err := ParseRule(test.rulestring)
+		if (err != nil) != test.failed {
+			t.Errorf("ERROR: %q: expected failure %v, got error %v", test.rulestring, test.failed, err)
+			continue
+		}
+		if !test.failed && rule != test.rule {
+			t.Errorf("ERROR: %q: expected %v, got %v", test.rulestring, test.rule, rule)
+		}
+	}
+}
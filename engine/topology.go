@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Topology says what lies beyond the edges of the board.
+type Topology int
+
+const (
+	// Torus wraps both edges round to the opposite side. It is the zero value.
+	Torus Topology = iota
+	// Dead surrounds the board with cells that are always dead.
+	Dead
+	// Reflect mirrors the board at its edges, so each edge cell is also its own outside neighbour.
+	Reflect
+	// Klein wraps left to right like a torus but flips the board left-to-right when wrapping
+	// between top and bottom.
+	Klein
+)
+
+var topologyNames = map[Topology]string{
+	Torus:   "torus",
+	Dead:    "dead",
+	Reflect: "reflect",
+	Klein:   "klein",
+}
+
+// ParseTopology reads a topology by name: torus, dead, reflect or klein.
+func ParseTopology(name string) (Topology, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for t, n := range topologyNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return Torus, fmt.Errorf("invalid topology %q: expected torus, dead, reflect or klein", name)
+}
+
+func (t Topology) String() string {
+	if name, ok := topologyNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Topology(%d)", int(t))
+}
+
+// Set lets a Topology be used directly as a command-line flag.
+func (t *Topology) Set(name string) error {
+	topology, err := ParseTopology(name)
+	if err != nil {
+		return err
+	}
+	*t = topology
+	return nil
+}
+
+// Beyond returns the rows just above the first row and just below the last row of the board,
+// which become the halos of the top and bottom strips.
+func (t Topology) Beyond(first, last []uint8) (above, below []uint8) {
+	switch t {
+	case Dead:
+		return make([]uint8, len(first)), make([]uint8, len(last))
+	case Reflect:
+		return first, last
+	case Klein:
+		return reversed(last), reversed(first)
+	default:
+		return last, first
+	}
+}
+
+// column maps a column that may be just off the left or right edge onto the board.
+// ok is false when the column is outside a dead border.
+func (t Topology) column(x, width int) (nx int, ok bool) {
+	switch {
+	case x >= 0 && x < width:
+		return x, true
+	case t == Dead:
+		return 0, false
+	case t == Reflect && x < 0:
+		return 0, true
+	case t == Reflect:
+		return width - 1, true
+	case x < 0:
+		return width - 1, true
+	default:
+		return 0, true
+	}
+}
+
+func reversed(row []uint8) []uint8 {
+	r := make([]uint8, len(row))
+	for i, cell := range row {
+		r[len(row)-1-i] = cell
+	}
+	return r
+}
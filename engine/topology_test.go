@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomWorld makes a board with about a third of its cells alive.
+func randomWorld(width, height int, seed int64) [][]uint8 {
+	random := rand.New(rand.NewSource(seed))
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = make([]uint8, width)
+		for x := range world[y] {
+			if random.Intn(3) == 0 {
+				world[y][x] = 255
+			}
+		}
+	}
+	return world
+}
+
+// cellAt looks up a cell that may be just off the board, as each topology says it lies.
+func cellAt(world [][]uint8, x, y int, topology Topology) uint8 {
+	height, width := len(world), len(world[0])
+	wrap := func(i, n int) int { return (i + n) % n }
+	clamp := func(i, n int) int {
+		if i < 0 {
+			return 0
+		} else if i >= n {
+			return n - 1
+		}
+		return i
+	}
+	switch topology {
+	case Dead:
+		if x < 0 || x >= width || y < 0 || y >= height {
+			return 0
+		}
+		return world[y][x]
+	case Reflect:
+		return world[clamp(y, height)][clamp(x, width)]
+	case Klein:
+		// crossing the top or bottom edge comes back in at the other, flipped left-to-right
+		if y < 0 || y >= height {
+			return world[wrap(y, height)][width-1-wrap(x, width)]
+		}
+		return world[y][wrap(x, width)]
+	default:
+		return world[wrap(y, height)][wrap(x, width)]
+	}
+}
+
+// referenceStep steps a whole board once, looking every neighbour up with cellAt.
+func referenceStep(world [][]uint8, rule Rule, topology Topology) [][]uint8 {
+	next := make([][]uint8, len(world))
+	for y := range world {
+		next[y] = make([]uint8, len(world[y]))
+		for x := range world[y] {
+			neighbours := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && cellAt(world, x+dx, y+dy, topology) == 255 {
+						neighbours++
+					}
+				}
+			}
+			next[y][x] = rule.NextLevel(world[y][x], neighbours)
+		}
+	}
+	return next
+}
+
+// stepStrips steps a board split into strips, each given the rows either side of it as halos,
+// as the workers are.
+func stepStrips(world [][]uint8, strips int, rule Rule, topology Topology) [][]uint8 {
+	height, width := len(world), len(world[0])
+	above, below := topology.Beyond(world[0], world[height-1])
+	var next [][]uint8
+	for i := 0; i < strips; i++ {
+		start, end := i*height/strips, (i+1)*height/strips
+		top, bottom := above, below
+		if start > 0 {
+			top = world[start-1]
+		}
+		if end < height {
+			bottom = world[end]
+		}
+		next = append(next, Step(world[start:end], top, bottom, width, rule, topology)...)
+	}
+	return next
+}
+
+// TestTopologies tests Step on every topology, on the whole board and split into strips,
+// against looking up each neighbour where the topology says it lies.
+func TestTopologies(t *testing.T) {
+	for _, topology := range []Topology{Torus, Dead, Reflect, Klein} {
+		for _, size := range [][2]int{{16, 16}, {37, 23}, {5, 9}} {
+			world := randomWorld(size[0], size[1], 1)
+			for turn := 1; turn <= 20; turn++ {
+				expected := referenceStep(world, Conway, topology)
+				for _, strips := range []int{1, 2, 3} {
+					if got := stepStrips(world, strips, Conway, topology); !reflect.DeepEqual(got, expected) {
+						t.Fatalf("ERROR: %vx%v on a %v in %v strips: turn %v differs from the reference",
+							size[0], size[1], topology, strips, turn)
+					}
+				}
+				world = expected
+			}
+		}
+	}
+}
+
+func TestParseTopology(t *testing.T) {
+	for _, topology := range []Topology{Torus, Dead, Reflect, Klein} {
+		parsed, err := ParseTopology(topology.String())
+		if err != nil || parsed != topology {
+			t.Errorf("ERROR: expected %v to parse back, got %v and %v", topology, parsed, err)
+		}
+	}
+	if _, err := ParseTopology("sphere"); err == nil {
+		t.Error("ERROR: expected an unknown topology to be turned down")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// rejectingBroker turns down every run it is asked to process.
+type rejectingBroker struct{}
+
+func (b *rejectingBroker) ProcessTurns(req stubs.Request, res *stubs.Response) error {
+	return errors.New("nothing to restart with")
+}
+
+func (b *rejectingBroker) GetFlips(req stubs.FlipsRequest, res *stubs.FlipsResponse) error {
+	res.Known, res.Done = true, true
+	return nil
+}
+
+func (b *rejectingBroker) Subscribe(req stubs.SubscribeRequest, res *stubs.Progress) error {
+	time.Sleep(req.Every)
+	res.Version = req.After
+	return nil
+}
+
+// TestErrorOccurred tests that a broker that cannot be reached, or that turns the run down,
+// ends the game with an ErrorOccurred event naming what failed.
+func TestErrorOccurred(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Server", &rejectingBroker{}); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go server.Accept(listener)
+
+	// a port that was just free is very unlikely to have been taken again
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name, server, operation string
+	}{
+		{"unreachable", unreachable, "connect"},
+		{"rejected", listener.Addr().String(), stubs.Turns},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := gol.Params{
+				Turns:       10,
+				Threads:     4,
+				ImageWidth:  16,
+				ImageHeight: 16,
+				Server:      test.server,
+				Mode:        gol.Distributed,
+				OutDir:      t.TempDir(),
+			}
+			cells, failures, err := runImage(p)
+			if err == nil {
+				t.Fatal("ERROR: Run succeeded")
+			}
+			if cells != nil {
+				t.Errorf("ERROR: a failed run reported a final board")
+			}
+			if len(failures) != 1 || failures[0].Operation != test.operation || failures[0].Err != err {
+				t.Errorf("ERROR: expected one ErrorOccurred for %v with the returned error, got %v", test.operation, failures)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// flakyFlipsBroker runs a game of turns turns for a second, failing the first fails calls to
+// GetFlips and then handing over a diff for every turn at once.
+type flakyFlipsBroker struct {
+	turns, fails int
+
+	mu    sync.Mutex
+	polls int
+}
+
+func (b *flakyFlipsBroker) ProcessTurns(req stubs.Request, res *stubs.Response) error {
+	time.Sleep(time.Second)
+	res.Turns, res.NewWorld = req.Turns, req.OldWorld
+	return nil
+}
+
+func (b *flakyFlipsBroker) GetFlips(req stubs.FlipsRequest, res *stubs.FlipsResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.polls++
+	if b.polls <= b.fails {
+		return errors.New("stream lost")
+	}
+	for turn := 1; turn <= b.turns; turn++ {
+		res.Diffs = append(res.Diffs, stubs.TurnDiff{Turn: turn})
+	}
+	res.Known, res.Done = true, true
+	return nil
+}
+
+func (b *flakyFlipsBroker) Subscribe(req stubs.SubscribeRequest, res *stubs.Progress) error {
+	time.Sleep(req.Every)
+	res.Version = req.After
+	return nil
+}
+
+// TestFlipsFailing tests that a broker that fails to hand over diffs for a while is only
+// reported once, and that the diffs it hands over once it recovers still reach the GUI.
+func TestFlipsFailing(t *testing.T) {
+	broker := &flakyFlipsBroker{turns: 10, fails: 3}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Server", broker); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go server.Accept(listener)
+
+	p := gol.Params{
+		Turns:       broker.turns,
+		ImageWidth:  16,
+		ImageHeight: 16,
+		Server:      listener.Addr().String(),
+		Mode:        gol.Distributed,
+		OutDir:      t.TempDir(),
+	}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+
+	var failures []gol.ErrorOccurred
+	turns := 0
+	timeout(t, 10*time.Second, func() {
+		for event := range events {
+			switch e := event.(type) {
+			case gol.ErrorOccurred:
+				failures = append(failures, e)
+			case gol.TurnComplete:
+				turns++
+			case gol.FinalTurnComplete:
+				if turns != broker.turns {
+					t.Errorf("ERROR: expected a TurnComplete for each of the %v turns before FinalTurnComplete, got %v", broker.turns, turns)
+				}
+			}
+		}
+	}, "Your program has not returned from the gol.Run function while GetFlips was failing")
+	if len(failures) != 1 || failures[0].Operation != stubs.GetFlips {
+		t.Errorf("ERROR: expected one ErrorOccurred for %v, got %v", stubs.GetFlips, failures)
+	}
+}
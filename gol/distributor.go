@@ -1,9 +1,14 @@
 package gol
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/rpc"
+	"sync"
 	"time"
 	"uk.ac.bris.cs/gameoflife/stubs"
 	"uk.ac.bris.cs/gameoflife/util"
@@ -15,10 +20,14 @@ type distributorChannels struct {
 	events     chan<- Event
 	ioCommand  chan<- ioCommand
 	ioIdle     <-chan bool
+	ioErrors   <-chan error
 	ioFilename chan<- string
 	ioOutput   chan<- uint8
 	ioInput    <-chan uint8
 	keyPresses <-chan rune
+	// ioLock keeps the commands of one image or frame from mixing with another's, as frames
+	// are recorded while the user may be saving snapshots.
+	ioLock *sync.Mutex
 }
 
 // Create and initialize a new 2D grid with given dimensions
@@ -30,18 +39,31 @@ func initializeWorld(height, width int) [][]uint8 {
 	return world
 }
 
-func loadInitialState(p Params, c distributorChannels) [][]uint8 {
+func loadInitialState(p Params, c distributorChannels) ([][]uint8, error) {
 	world := initializeWorld(p.ImageHeight, p.ImageWidth)
-	filename := fmt.Sprintf("%vx%v", p.ImageWidth, p.ImageHeight)
-	c.ioCommand <- ioInput
-	c.ioFilename <- filename
+	if p.Pattern != "" {
+		c.ioCommand <- ioPatternInput
+		c.ioFilename <- p.Pattern
+	} else {
+		c.ioCommand <- ioInput
+		c.ioFilename <- p.inputPath()
+	}
+	if err := <-c.ioErrors; err != nil {
+		return nil, err
+	}
 
+	// multi-state boards can start with dying cells, which a flip cannot show
+	shaded := p.Rule.OrDefault().States > 2
+	updated := CellsUpdated{CompletedTurns: 0}
 	for y := 0; y < p.ImageHeight; y++ {
 		for x := 0; x < p.ImageWidth; x++ {
 			value := <-c.ioInput
-			world[x][y] = value
+			world[y][x] = value
 
-			if value == 255 {
+			if shaded && value != 0 {
+				updated.Cells = append(updated.Cells, util.Cell{X: x, Y: y})
+				updated.Levels = append(updated.Levels, value)
+			} else if !shaded && value == 255 {
 
 				c.events <- CellFlipped{
 					CompletedTurns: 0,
@@ -50,164 +72,379 @@ func loadInitialState(p Params, c distributorChannels) [][]uint8 {
 			}
 		}
 	}
-	c.ioCommand <- ioCheckIdle
-	<-c.ioIdle
-	return world
+	if len(updated.Cells) > 0 {
+		c.events <- updated
+	}
+	return world, nil
 }
 
-func saveGameState(p Params, c distributorChannels, turns int, world [][]uint8) {
+func saveGameState(p Params, c distributorChannels, turns int, world [][]uint8) error {
+	c.ioLock.Lock()
 	c.ioCommand <- ioOutput
-	filename := fmt.Sprintf("%vx%vx%v", p.ImageWidth, p.ImageHeight, turns)
+	filename := p.outputName(turns)
 	c.ioFilename <- filename
 
 	for y := 0; y < p.ImageHeight; y++ {
 		for x := 0; x < p.ImageWidth; x++ {
-			c.ioOutput <- world[x][y]
+			c.ioOutput <- world[y][x]
 		}
 	}
 
-	c.ioCommand <- ioCheckIdle
-	<-c.ioIdle
+	err := <-c.ioErrors
+	c.ioLock.Unlock()
+	if err != nil {
+		return err
+	}
 	c.events <- ImageOutputComplete{turns, filename}
+	return nil
 }
 
-// Send an RPC call to the server and retrieve the updated game state
-func executeTurn(client *rpc.Client, req stubs.Request, res *stubs.Response) {
-	if err := client.Call(stubs.Turns, req, &res); err != nil {
-		fmt.Println(err)
+// recordFrame adds the board at turn to the GIF if turn is one Params.GifEvery asks for.
+func recordFrame(p Params, c distributorChannels, turn int, world [][]uint8) error {
+	if p.GifEvery <= 0 || turn%p.GifEvery != 0 {
+		return nil
 	}
+	c.ioLock.Lock()
+	defer c.ioLock.Unlock()
+
+	c.ioCommand <- ioFrame
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			c.ioOutput <- world[y][x]
+		}
+	}
+	return <-c.ioErrors
 }
 
-func getCount(client *rpc.Client, c distributorChannels) {
-	res := new(stubs.ResponseAlive)
-	if err := client.Call(stubs.Alive, stubs.EmptyReq{}, &res); err != nil {
-		fmt.Println(err)
+// saveRecording writes the recorded frames to the GIF named after the final image.
+func saveRecording(p Params, c distributorChannels, turns int) error {
+	if p.GifEvery <= 0 {
+		return nil
 	}
-	c.events <- AliveCellsCount{res.Turn, res.NumAlive}
+	c.ioLock.Lock()
+	defer c.ioLock.Unlock()
+
+	c.ioCommand <- ioRecordingOutput
+	c.ioFilename <- p.outputName(turns)
+	return <-c.ioErrors
 }
 
-func quitServer(client *rpc.Client) {
-	res := stubs.EmptyRes{}
-	if err := client.Call(stubs.QuitServer, stubs.EmptyReq{}, &res); err != nil {
-		fmt.Println(err)
+// report tells the user about a failed operation without stopping the game.
+func report(c distributorChannels, turn int, operation string, err error) {
+	// the client is only shut down once the run is over and events may be closed; a broker
+	// that goes away mid-run is reported by the ProcessTurns call instead
+	if errors.Is(err, rpc.ErrShutdown) {
+		return
+	}
+	// a cancelled game returns why it was cancelled rather than reporting every call it cut short
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
 	}
+	c.events <- ErrorOccurred{turn, operation, err}
 }
 
-func quitClient(client *rpc.Client) {
-	res := stubs.EmptyRes{}
-	if err := client.Call(stubs.QuitClient, stubs.EmptyReq{}, &res); err != nil {
-		fmt.Println(err)
+// call makes an RPC to the broker, giving up with ErrTimeout once timeout has passed, or with
+// ctx.Err() once ctx is done. A zero timeout waits for as long as ctx allows.
+func call(ctx context.Context, client *rpc.Client, timeout time.Duration, method string, args, reply interface{}) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	// the reply may still arrive after giving up, so it is only read once the call is done
+	pending := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-pending.Done:
+		return pending.Error
+	case <-expired:
+		return ErrTimeout
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-func quitClientPaused(client *rpc.Client) {
+// Send an RPC call to the server and retrieve the updated game state. The run is not bound by
+// Params.Timeout, as it lasts as long as the game does.
+func executeTurn(ctx context.Context, client *rpc.Client, req stubs.Request, res *stubs.Response) error {
+	return call(ctx, client, 0, stubs.Turns, req, res)
+}
+
+// sessionRequest names the session and the run a control request is for.
+func (p Params) sessionRequest() stubs.SessionRequest {
+	return stubs.SessionRequest{Session: p.Session, Run: p.run}
+}
+
+// cancelRun tells the broker to stop the session's run. It is used once ctx is done, so it
+// has only Params.Timeout to get through.
+func cancelRun(client *rpc.Client, p Params) error {
 	res := stubs.EmptyRes{}
-	if err := client.Call(stubs.QuitClientPaused, stubs.EmptyReq{}, &res); err != nil {
-		fmt.Println(err)
-	}
+	return call(context.Background(), client, p.Timeout, stubs.Cancel, p.sessionRequest(), &res)
 }
 
-func pauseClient(client *rpc.Client) int {
+func quitServer(ctx context.Context, client *rpc.Client, p Params) error {
+	res := stubs.EmptyRes{}
+	return call(ctx, client, p.Timeout, stubs.QuitServer, p.sessionRequest(), &res)
+}
+
+func quitClient(ctx context.Context, client *rpc.Client, p Params) error {
+	res := stubs.EmptyRes{}
+	return call(ctx, client, p.Timeout, stubs.QuitClient, p.sessionRequest(), &res)
+}
+
+func quitClientPaused(ctx context.Context, client *rpc.Client, p Params) error {
+	res := stubs.EmptyRes{}
+	return call(ctx, client, p.Timeout, stubs.QuitClientPaused, p.sessionRequest(), &res)
+}
+
+func pauseClient(ctx context.Context, client *rpc.Client, p Params) (int, error) {
 	res := new(stubs.ResponseTurn)
-	if err := client.Call(stubs.Pause, stubs.EmptyReq{}, &res); err != nil {
-		fmt.Println(err)
+	if err := call(ctx, client, p.Timeout, stubs.Pause, p.sessionRequest(), res); err != nil {
+		return 0, err
 	}
-	return res.Turn
+	return res.Turn, nil
 }
 
-func unpauseClient(client *rpc.Client) {
-	if err := client.Call(stubs.Unpause, stubs.EmptyReq{}, &stubs.EmptyRes{}); err != nil {
-		fmt.Println(err)
-	}
+func unpauseClient(ctx context.Context, client *rpc.Client, p Params) error {
+	return call(ctx, client, p.Timeout, stubs.Unpause, p.sessionRequest(), &stubs.EmptyRes{})
 }
 
-func snapshot(client *rpc.Client, p Params, c distributorChannels) {
+// snapshot saves the board the broker is working on, using method to ask for it.
+func snapshot(ctx context.Context, client *rpc.Client, p Params, c distributorChannels, method string) {
 	res := new(stubs.ResponseSnapshot)
-	if err := client.Call(stubs.Snapshot, stubs.EmptyReq{}, &res); err != nil {
-		fmt.Println(err)
+	if err := call(ctx, client, p.Timeout, method, p.sessionRequest(), res); err != nil {
+		report(c, 0, method, err)
+		return
+	}
+	if err := saveGameState(p, c, res.Turns, res.NewWorld); err != nil {
+		report(c, res.Turns, "save", err)
 	}
-	saveGameState(p, c, res.Turns, res.NewWorld)
 }
 
-func pausedSnapshot(client *rpc.Client, p Params, c distributorChannels) {
-	res := new(stubs.ResponseSnapshot)
-	if err := client.Call(stubs.PausedSnapshot, stubs.EmptyReq{}, &res); err != nil {
-		fmt.Println(err)
-	}
-	saveGameState(p, c, res.Turns, res.NewWorld)
+// NewSessionID makes up a session name that no other controller will pick.
+func NewSessionID() string {
+	return randomID()
 }
 
-func runTicker(done chan bool, client *rpc.Client, c distributorChannels) {
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+// randomID names a session or a stream of turn diffs.
+func randomID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprint(time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
 
+// streamFlips forwards the broker's turn diffs as CellsFlipped and TurnComplete events until
+// the stream ends. finished is closed once the run has returned, so a stream the broker never
+// opened is not waited on forever. The diffs are applied to world, a copy of the starting board,
+// so that GIF frames can be recorded without asking the broker for the board.
+func streamFlips(ctx context.Context, client *rpc.Client, p Params, c distributorChannels, stream string, world [][]uint8, finished <-chan bool, done chan<- int) {
+	// done is sent the last turn forwarded, for reporting a run that fails
+	turn := 0
+	defer func() {
+		done <- turn
+		close(done)
+	}()
+	// backoff is how long to wait after a failed poll. Only the first failure is reported; the
+	// polls after it back off quietly until one gets through, and the diffs the broker queued
+	// in the meantime are forwarded then.
+	var backoff time.Duration
 	for {
-		select {
-		case <-done:
+		res := new(stubs.FlipsResponse)
+		if err := call(ctx, client, p.Timeout, stubs.GetFlips, stubs.FlipsRequest{Stream: stream}, res); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if backoff == 0 {
+				report(c, turn, stubs.GetFlips, err)
+				backoff = firstFlipsBackoff
+			} else if backoff < maxFlipsBackoff {
+				backoff *= 2
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-finished:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+		for _, diff := range res.Diffs {
+			turn = diff.Turn
+			for i, cell := range diff.Cells {
+				world[cell.Y][cell.X] = diff.Levels[i]
+			}
+			recordTurn(&p, c, diff.Turn, world)
+			sendChanges(p, c, diff.Turn, diff.Cells, diff.Levels)
+			c.events <- TurnComplete{diff.Turn}
+		}
+		if res.Done {
 			return
-		case _ = <-ticker.C:
-			getCount(client, c)
+		}
+		if !res.Known {
+			select {
+			case <-finished:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// firstFlipsBackoff is how long streamFlips waits after the first of a run of failed polls. The
+// wait doubles up to maxFlipsBackoff, which is well inside how long the broker waits for a
+// stream that is not being read before it drops it.
+const (
+	firstFlipsBackoff = 100 * time.Millisecond
+	maxFlipsBackoff   = 2 * time.Second
+)
 
+// maxProgressBackoff is as long as runProgress waits between polls while the broker keeps failing them.
+const maxProgressBackoff = 30 * time.Second
+
+// runProgress subscribes to the session's progress on the broker, sending the alive count
+// it publishes every Params.CountEvery until ctx is done. The broker publishes each turn as
+// it completes, so the run is never held up for a count.
+func runProgress(ctx context.Context, client *rpc.Client, p Params, c distributorChannels) {
+	req := stubs.SubscribeRequest{Session: p.Session, Every: p.CountEvery}
+	// backoff is how long to wait after a failed poll. Only the first failure is reported; the
+	// polls after it back off quietly until one gets through.
+	var backoff time.Duration
+	for ctx.Err() == nil {
+		res := new(stubs.Progress)
+		// the broker may take up to its poll on top of Every to answer
+		if err := call(ctx, client, p.Timeout+p.CountEvery, stubs.Subscribe, req, res); err != nil {
+			if backoff == 0 {
+				report(c, 0, stubs.Subscribe, err)
+				backoff = p.CountEvery
+			} else if backoff < maxProgressBackoff {
+				backoff *= 2
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+		req.After = res.Version
+		// before the run starts, or after it ends, the count is the previous run's
+		if res.Running && res.Turn > 0 {
+			c.events <- AliveCellsCount{res.Turn, res.Alive}
 		}
 	}
 }
 
-func paused(client *rpc.Client, c distributorChannels, p Params) {
-	turn := pauseClient(client)
+func paused(ctx context.Context, client *rpc.Client, c distributorChannels, p Params, finished <-chan bool) {
+	turn, err := pauseClient(ctx, client, p)
+	if err != nil {
+		report(c, turn, stubs.Pause, err)
+		return
+	}
 	c.events <- StateChange{turn, Paused}
 
-	for keyNew := range c.keyPresses {
+	for {
+		keyNew, ok := nextKey(c, finished)
+		if !ok {
+			return
+		}
 		switch keyNew {
 		case 's':
-			pausedSnapshot(client, p, c)
+			snapshot(ctx, client, p, c, stubs.PausedSnapshot)
 		case 'p':
-			unpauseClient(client)
+			if err := unpauseClient(ctx, client, p); err != nil {
+				report(c, turn, stubs.Unpause, err)
+			}
 			c.events <- StateChange{turn, Executing}
 			return
 		case 'q':
-			quitClientPaused(client)
+			if err := quitClientPaused(ctx, client, p); err != nil {
+				report(c, turn, stubs.QuitClientPaused, err)
+			}
 			quit = true
 			return
 		}
 	}
 }
 
-func runKeyPressController(client *rpc.Client, c distributorChannels, p Params) {
-	for key := range c.keyPresses {
+// nextKey waits for a key press, giving up once finished is closed. A run that has finished
+// is checked first, so keys pressed as it ends are not sent to a session with nothing running.
+func nextKey(c distributorChannels, finished <-chan bool) (rune, bool) {
+	select {
+	case <-finished:
+		return 0, false
+	default:
+	}
+	select {
+	case <-finished:
+		return 0, false
+	case key, ok := <-c.keyPresses:
+		return key, ok
+	}
+}
+
+// runKeyPressController acts on key presses until the run finishes. The distributor waits for
+// it to return before closing events.
+func runKeyPressController(ctx context.Context, client *rpc.Client, c distributorChannels, p Params, finished <-chan bool) {
+	for {
+		key, ok := nextKey(c, finished)
+		if !ok {
+			return
+		}
 		switch key {
 		case 'k':
-			quitServer(client)
+			if err := quitServer(ctx, client, p); err != nil {
+				report(c, 0, stubs.QuitServer, err)
+			}
 			return
 		case 's':
-			snapshot(client, p, c)
+			snapshot(ctx, client, p, c, stubs.Snapshot)
 		case 'q':
-			quitClient(client)
+			if err := quitClient(ctx, client, p); err != nil {
+				report(c, 0, stubs.QuitClient, err)
+			}
 			quit = true
 			return
 		case 'p':
-			paused(client, c, p)
+			paused(ctx, client, c, p, finished)
 		}
 	}
 }
 
 func copyOf(world [][]uint8, p Params) [][]uint8 {
 	worldNew := initializeWorld(p.ImageHeight, p.ImageWidth)
-	copy(worldNew, world)
+	for y := range worldNew {
+		copy(worldNew[y], world[y])
+	}
 	return worldNew
 }
 
-// Manage client-server interaction and distribute work across routines
-func distributor(p Params, c distributorChannels, restart bool) {
+// dialTimeout bounds how long Run waits for the broker before giving up on it.
+const dialTimeout = 2 * time.Second
 
-	serverAddress := "54.152.194.255:8030"
-	client, err := rpc.Dial("tcp", serverAddress)
+// dialBroker connects to the broker named in p.
+func dialBroker(ctx context.Context, p Params) (*rpc.Client, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.Server)
 	if err != nil {
-		log.Fatal("dialing", err)
+		return nil, err
 	}
+	return rpc.NewClient(conn), nil
+}
+
+// Manage client-server interaction and distribute work across routines
+func distributor(ctx context.Context, p Params, c distributorChannels, client *rpc.Client, restart bool) error {
 	defer client.Close()
 
-	initialWorld := loadInitialState(p, c)
+	initialWorld, err := loadInitialState(p, c)
+	if err != nil {
+		return abort(c.events, "load", err)
+	}
 
+	p.run = randomID()
 	req := stubs.Request{
 		OldWorld:    initialWorld,
 		Turns:       p.Turns,
@@ -215,26 +452,68 @@ func distributor(p Params, c distributorChannels, restart bool) {
 		ImageWidth:  p.ImageWidth,
 		ImageHeight: p.ImageHeight,
 		Restart:     restart,
+		Rule:        p.Rule,
+		Topology:    p.Topology,
+		Session:     p.Session,
+		Stream:      p.run,
+		Packed:      p.Engine == Packed,
 	}
 	res := new(stubs.Response)
 
-	done := make(chan bool)
-	defer close(done)
-	go runTicker(done, client, c)
-	go runKeyPressController(client, c, p)
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	defer stopProgress()
+	progressDone := make(chan bool)
+	go func() {
+		runProgress(progressCtx, client, p, c)
+		close(progressDone)
+	}()
+	finished := make(chan bool)
+	keysDone := make(chan bool)
+	go func() {
+		runKeyPressController(ctx, client, c, p, finished)
+		close(keysDone)
+	}()
 
 	c.events <- StateChange{0, Executing}
-	executeTurn(client, req, res)
-
-	saveGameState(p, c, res.Turns, copyOf(res.NewWorld, p))
-	c.events <- FinalTurnComplete{
-		CompletedTurns: res.Turns,
-		Alive:          res.AliveCellLocation,
+	if !restart {
+		recordTurn(&p, c, 0, initialWorld)
+	}
+	flipsDone := make(chan int, 1)
+	go streamFlips(ctx, client, p, c, req.Stream, copyOf(initialWorld, p), finished, flipsDone)
+	runErr := executeTurn(ctx, client, req, res)
+	cancelled := runErr != nil && ctx.Err() != nil
+	if cancelled {
+		// the broker is told to stop, but the board it stops with is not waited for
+		if err := cancelRun(client, p); err != nil {
+			report(c, 0, stubs.Cancel, err)
+		}
+	}
+	close(finished)
+	// every TurnComplete has to reach the GUI before FinalTurnComplete
+	turn := <-flipsDone
+	// a key press being acted on may still send events
+	<-keysDone
+
+	if cancelled {
+		err = ctx.Err()
+	} else if runErr != nil {
+		// the broker turned the run down or was lost, so there is no final board to report
+		err = runErr
+		report(c, turn, stubs.Turns, err)
+	} else {
+		turn = res.Turns
+		err = saveFinal(p, c, res.Turns, copyOf(res.NewWorld, p))
+		c.events <- FinalTurnComplete{
+			CompletedTurns: res.Turns,
+			Alive:          res.AliveCellLocation,
+		}
 	}
 
 	c.ioCommand <- ioCheckIdle
 	<-c.ioIdle
-	c.events <- StateChange{res.Turns, Quitting}
-	done <- true
+	stopProgress()
+	<-progressDone
+	c.events <- StateChange{turn, Quitting}
 	close(c.events)
+	return err
 }
@@ -63,6 +63,15 @@ type CellsFlipped struct { // implements Event
 	Cells          []util.Cell
 }
 
+// `CellsUpdated` is an Event notifying the GUI about cells taking new grey levels under a multi-state (Generations) rule.
+// Levels[i] is the new level of Cells[i]: 0 for dead, 255 for alive and anything in between for a dying cell.
+// It is sent instead of `CellFlipped`/`CellsFlipped` whenever the rule has more than two states.
+type CellsUpdated struct { // implements Event
+	CompletedTurns int
+	Cells          []util.Cell
+	Levels         []uint8
+}
+
 // `TurnComplete` is an Event notifying the GUI about turn completion.
 // SDL will render a frame when this event is sent.
 // All `CellFlipped` or `CellsFlipped` events must be sent *before* `TurnComplete`.
@@ -70,6 +79,17 @@ type TurnComplete struct { // implements Event
 	CompletedTurns int
 }
 
+// `ErrorOccurred` is an Event notifying the user that something went wrong, such as an image that could not be read or
+// written or an RPC call that failed or was turned down by the broker.
+// Operation names what failed: the RPC method (e.g. "Server.Pause"), or "load", "save", "record", "connect" or "params".
+// If the error ends the game, it is followed by a `StateChange` to `Quitting` and returned by `Run`;
+// otherwise, as for a failed snapshot, the game carries on.
+type ErrorOccurred struct { // implements Event
+	CompletedTurns int
+	Operation      string
+	Err            error
+}
+
 // `FinalTurnComplete` is an Event notifying the testing framework about the new world state after execution finished.
 // The data included with this Event is used directly by the tests.
 // SDL closes the window when this Event is sent.
@@ -133,6 +153,14 @@ func (event CellsFlipped) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event CellsUpdated) String() string {
+	return ""
+}
+
+func (event CellsUpdated) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event TurnComplete) String() string {
 	return ""
 }
@@ -141,6 +169,14 @@ func (event TurnComplete) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event ErrorOccurred) String() string {
+	return fmt.Sprintf("Error (%v): %v", event.Operation, event.Err)
+}
+
+func (event ErrorOccurred) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event FinalTurnComplete) String() string {
 	return "Final Turn Complete"
 }
@@ -1,23 +1,252 @@
 package gol
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+)
+
+// DefaultServer is the broker address used when Params.Server is left empty.
+const DefaultServer = "127.0.0.1:8030"
+
+// DefaultTimeout is how long a request to the broker may take when Params.Timeout is left at zero.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultCountEvery is how often AliveCellsCount is sent when Params.CountEvery is left at zero.
+const DefaultCountEvery = 2 * time.Second
+
+// ErrTimeout is the error of a request the broker did not answer within Params.Timeout.
+var ErrTimeout = errors.New("broker did not answer in time")
+
+// Mode chooses where the game is computed.
+type Mode int
+
+const (
+	// Auto uses the broker if it can be reached and computes locally otherwise. It is the zero value.
+	Auto Mode = iota
+	// Local always computes in this process, using Params.Threads goroutines.
+	Local
+	// Distributed always uses the broker and gives up if it cannot be reached.
+	Distributed
+)
+
+var modeNames = map[Mode]string{
+	Auto:        "auto",
+	Local:       "local",
+	Distributed: "distributed",
+}
+
+func (m Mode) String() string {
+	if name, ok := modeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// Set lets a Mode be used directly as a command-line flag.
+func (m *Mode) Set(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for mode, n := range modeNames {
+		if n == name {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid mode %q: expected auto, local or distributed", name)
+}
+
+// Algorithm chooses how turns are computed.
+type Algorithm int
+
+const (
+	// BruteForce works out every cell every turn, locally or on the broker. It is the zero value.
+	BruteForce Algorithm = iota
+	// HashLife jumps ahead many turns at a time using engine.HashLife. It runs in this process,
+	// on square boards whose side is a power of two, with two-state rules on a torus.
+	HashLife
+	// Packed works out every cell every turn like BruteForce, but on bit-packed boards, 64 cells
+	// at a time, locally or on the broker's workers. It needs a two-state rule.
+	Packed
+)
+
+var algorithmNames = map[Algorithm]string{
+	BruteForce: "brute",
+	HashLife:   "hashlife",
+	Packed:     "packed",
+}
+
+func (a Algorithm) String() string {
+	if name, ok := algorithmNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+// Set lets an Algorithm be used directly as a command-line flag.
+func (a *Algorithm) Set(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for algorithm, n := range algorithmNames {
+		if n == name {
+			*a = algorithm
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid engine %q: expected brute, hashlife or packed", name)
+}
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
 	Turns       int
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+	Server      string
+	// Timeout bounds every request to the broker except the run itself, which lasts until it
+	// finishes or the context given to RunContext is done. Zero means DefaultTimeout.
+	Timeout time.Duration
+	// CountEvery is how often AliveCellsCount is sent. Zero means DefaultCountEvery.
+	CountEvery time.Duration
+	// Session names this controller's run on the broker, so controllers sharing a broker keep
+	// out of each other's way. Restart resumes the session's last checkpoint, so it needs the
+	// session of the run being resumed. Empty starts a new session with a name from NewSessionID.
+	Session  string
+	Restart  bool
+	Rule     engine.Rule
+	Topology engine.Topology
+	// Mode picks the local engine or the broker. Restart needs the broker, so Auto will not
+	// fall back to the local engine for a restart.
+	Mode Mode
+	// Engine picks how turns are computed. HashLife always runs in this process, so it cannot
+	// be combined with Distributed or Restart.
+	Engine Algorithm
+	// Pattern is a pattern file (.rle, .cells or Life 1.06 .lif) to start from instead of images/WxH.pgm. It is placed with
+	// its top-left corner at (PatternX, PatternY) on an otherwise dead board.
+	Pattern  string
+	PatternX int
+	PatternY int
+	// Export lists formats ("rle", "cells", "life106", "pbm" or "png") written to out/ alongside every PGM image.
+	Export []string
+	// Plain writes PGM and PBM images in their plain (ASCII) formats, P2 and P1.
+	Plain bool
+	// Scale is the width in pixels of each cell in PNG and GIF output. Zero means 1.
+	Scale int
+	// Palette names the colours of PNG and GIF output (see Palettes). Empty means grey, like the PGMs.
+	Palette string
+	// GifEvery records every GifEvery-th turn into an animated GIF, named like the final image
+	// and written when the run ends. Zero records nothing.
+	GifEvery int
+	// Input is the PGM or PBM image to start from instead of images/WxH.pgm. Run reads ImageWidth and
+	// ImageHeight from its header when they are left at zero; see ImageSize.
+	Input string
+	// OutDir is the directory images and exports are written to. Empty means out.
+	OutDir string
+	// OutName is the template for the names of written files, without the extension.
+	// {name} is the input or pattern file's name, or WxH; {w}, {h} and {turns} are the board
+	// size and the turn. Empty means {w}x{h}x{turns}.
+	OutName string
+
+	// run names the run on the broker in every control request, so that one sent before the
+	// broker has started the run is kept for it. It is also the run's stream of turn diffs.
+	run string
 }
 
-// Run starts the processing of Game of Life. It should initialise channels and goroutines.
-func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
-	// this must be commented out for testing and the line at the bottom should be uncommented
-	//restart := flag.Bool("restart", false, "Did you disconnect and would like to continue")
-	//flag.Parse()
+// inputPath is the image the board starts from when there is no pattern.
+func (p Params) inputPath() string {
+	if p.Input != "" {
+		return p.Input
+	}
+	return fmt.Sprintf("images/%vx%v.pgm", p.ImageWidth, p.ImageHeight)
+}
+
+// outputDir is the directory written files go in.
+func (p Params) outputDir() string {
+	if p.OutDir == "" {
+		return "out"
+	}
+	return p.OutDir
+}
 
-	//	TODO: Put the missing channels in here.
+// outputName fills in the OutName template for the board at turns.
+func (p Params) outputName(turns int) string {
+	name := fmt.Sprintf("%vx%v", p.ImageWidth, p.ImageHeight)
+	source := p.Input
+	if p.Pattern != "" {
+		source = p.Pattern
+	}
+	if source != "" {
+		name = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	}
+	template := p.OutName
+	if template == "" {
+		template = "{w}x{h}x{turns}"
+	}
+	return strings.NewReplacer(
+		"{name}", name,
+		"{w}", strconv.Itoa(p.ImageWidth),
+		"{h}", strconv.Itoa(p.ImageHeight),
+		"{turns}", strconv.Itoa(turns),
+	).Replace(template)
+}
+
+// Run starts the processing of Game of Life. It should initialise channels and goroutines.
+// It returns once the game has finished and events is closed. Anything that stops the game,
+// such as an image that cannot be read, is returned and also sent as an ErrorOccurred event.
+func Run(p Params, events chan<- Event, keyPresses <-chan rune) error {
+	return RunContext(context.Background(), p, events, keyPresses)
+}
 
+// RunContext is Run, stopping the game once ctx is done. A cancelled game tells the broker
+// to stop its run, sends StateChange Quitting without a final board and returns ctx.Err().
+func RunContext(ctx context.Context, p Params, events chan<- Event, keyPresses <-chan rune) error {
+	p.Rule = p.Rule.OrDefault()
+	if p.Server == "" {
+		p.Server = DefaultServer
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultTimeout
+	}
+	if p.CountEvery <= 0 {
+		p.CountEvery = DefaultCountEvery
+	}
+	if _, err := palette(p.Palette); err != nil {
+		return abort(events, "params", err)
+	}
+	if p.Session == "" {
+		if p.Restart {
+			return abort(events, "params", errors.New("restart needs the session to resume"))
+		}
+		p.Session = NewSessionID()
+	}
+	if p.Input != "" && (p.ImageWidth == 0 || p.ImageHeight == 0) {
+		width, height, err := ImageSize(p.Input)
+		if err != nil {
+			return abort(events, "load", err)
+		}
+		p.ImageWidth, p.ImageHeight = width, height
+	}
+	if p.Engine == HashLife {
+		if p.Mode == Distributed || p.Restart {
+			return abort(events, "params", errors.New("hashlife runs in this process, not on the broker"))
+		}
+		if err := engine.HashLifeSupports(p.ImageWidth, p.ImageHeight, p.Rule, p.Topology); err != nil {
+			return abort(events, "params", err)
+		}
+	}
+	if p.Engine == Packed {
+		if err := engine.PackedSupports(p.Rule); err != nil {
+			return abort(events, "params", err)
+		}
+	}
 	ioCommand := make(chan ioCommand)
 	ioIdle := make(chan bool)
+	ioErrors := make(chan error)
 	ioFilename := make(chan string)
 	ioOutput := make(chan uint8, p.ImageWidth*p.ImageHeight)
 	ioInput := make(chan uint8, p.ImageWidth*p.ImageHeight)
@@ -25,6 +254,7 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 	ioChannels := ioChannels{
 		command:  ioCommand,
 		idle:     ioIdle,
+		errors:   ioErrors,
 		filename: ioFilename,
 		output:   ioOutput,
 		input:    ioInput,
@@ -35,13 +265,35 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		events:     events,
 		ioCommand:  ioCommand,
 		ioIdle:     ioIdle,
+		ioErrors:   ioErrors,
 		ioFilename: ioFilename,
 		ioOutput:   ioOutput,
 		ioInput:    ioInput,
 		keyPresses: keyPresses,
+		ioLock:     new(sync.Mutex),
 	}
 
-	distributor(p, distributorChannels, false)
-	//distributor(p, distributorChannels, *restart)
+	if p.Engine == HashLife {
+		return hashLifeDistributor(ctx, p, distributorChannels)
+	}
+	if p.Mode == Local {
+		return localDistributor(ctx, p, distributorChannels)
+	}
+	client, err := dialBroker(ctx, p)
+	if err != nil {
+		if p.Mode == Distributed || p.Restart || ctx.Err() != nil {
+			return abort(events, "connect", fmt.Errorf("cannot reach broker at %v: %w", p.Server, err))
+		}
+		return localDistributor(ctx, p, distributorChannels)
+	}
+	return distributor(ctx, p, distributorChannels, client, p.Restart)
+}
 
+// abort ends a game that could not start, sending the failed operation and Quitting
+// before closing events.
+func abort(events chan<- Event, operation string, err error) error {
+	events <- ErrorOccurred{0, operation, err}
+	events <- StateChange{0, Quitting}
+	close(events)
+	return err
 }
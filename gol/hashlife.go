@@ -0,0 +1,99 @@
+package gol
+
+import (
+	"context"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+)
+
+// hashLifeStep is about how long a single jump may take, so key presses and counts are never
+// held up for long. Jumps grow while they take much less and shrink when they take more.
+const hashLifeStep = 50 * time.Millisecond
+
+// hashLifeFrame is how often the board is shown while the game jumps ahead.
+const hashLifeFrame = 100 * time.Millisecond
+
+// nextJump returns the k of the longest jump of 2^k turns, up to 2^limit, that neither
+// passes the last turn nor skips a turn the GIF records.
+func nextJump(p Params, turn, limit int) int {
+	k := limit
+	for k > 0 && turn+1<<uint(k) > p.Turns {
+		k--
+	}
+	if p.GifEvery > 0 {
+		frame := (turn/p.GifEvery + 1) * p.GifEvery
+		for k > 0 && turn+1<<uint(k) > frame {
+			k--
+		}
+	}
+	return k
+}
+
+// hashLifeDistributor runs the game inside this process with engine.HashLife, jumping ahead
+// as many turns at a time as it can while still answering key presses and sending counts on
+// time. It sends the same events as localDistributor, except that only the turns the board is
+// shown at get a TurnComplete, with the cells changed since it was last shown.
+func hashLifeDistributor(ctx context.Context, p Params, c distributorChannels) error {
+	world, err := loadInitialState(p, c)
+	if err != nil {
+		return abort(c.events, "load", err)
+	}
+	life, err := engine.NewHashLife(world, p.Rule, p.Topology)
+	if err != nil {
+		return abort(c.events, "params", err)
+	}
+
+	ticker := time.NewTicker(p.CountEvery)
+	defer ticker.Stop()
+
+	c.events <- StateChange{0, Executing}
+	turn := 0
+	recordTurn(&p, c, turn, world)
+	shown := time.Now()
+	// show brings the GUI up to the current turn
+	show := func() {
+		next := life.World()
+		cells, levels := engine.Diff(world, next, 0)
+		world = next
+		sendChanges(p, c, turn, cells, levels)
+		c.events <- TurnComplete{turn}
+		shown = time.Now()
+	}
+	limit := 0
+	stopped := false
+	for turn < p.Turns && !stopped {
+		k := nextJump(p, turn, limit)
+		start := time.Now()
+		life.Jump(k)
+		turn += 1 << uint(k)
+		if took := time.Since(start); took < hashLifeStep/4 && limit < engine.MaxJump && k == limit {
+			limit++
+		} else if took > hashLifeStep && limit > 0 {
+			limit--
+		}
+
+		if p.GifEvery > 0 && turn%p.GifEvery == 0 {
+			recordTurn(&p, c, turn, life.World())
+		}
+		if time.Since(shown) >= hashLifeFrame || turn == p.Turns {
+			show()
+		}
+
+		select {
+		case <-ctx.Done():
+			stopped = true
+		case <-ticker.C:
+			c.events <- AliveCellsCount{turn, life.Alive()}
+		case key := <-c.keyPresses:
+			// the GUI is brought up to the turn the game pauses at
+			if key == 'p' && shown.Before(start) {
+				show()
+			}
+			stopped = localKey(ctx, p, c, key, turn, life.World)
+		default:
+		}
+	}
+
+	return finishLocal(ctx, p, c, turn, life.World())
+}
@@ -2,14 +2,14 @@ package gol
 
 import (
 	"os"
-	"strconv"
-	"strings"
-	"uk.ac.bris.cs/gameoflife/util"
+	"path/filepath"
 )
 
 type ioChannels struct {
 	command <-chan ioCommand
 	idle    chan<- bool
+	// errors answers every command except ioCheckIdle with nil or what went wrong.
+	errors chan<- error
 
 	filename <-chan string
 	output   <-chan uint8
@@ -18,8 +18,9 @@ type ioChannels struct {
 
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
-	params   Params
-	channels ioChannels
+	params    Params
+	channels  ioChannels
+	recording recording
 }
 
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
@@ -31,97 +32,128 @@ type ioCommand uint8
 //	ioOutput 	= 0
 //	ioInput 	= 1
 //	ioCheckIdle = 2
+//	ioPatternInput = 3
+//	ioFrame = 4
+//	ioRecordingOutput = 5
 const (
 	ioOutput ioCommand = iota
 	ioInput
 	ioCheckIdle
+	ioPatternInput
+	ioFrame
+	ioRecordingOutput
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
-func (io *ioState) writePgmImage() {
-	_ = os.Mkdir("out", os.ModePerm)
+// receiveWorld takes a whole board of bytes from the distributor.
+func (io *ioState) receiveWorld() [][]uint8 {
+	world := make([][]uint8, io.params.ImageHeight)
+	for y := range world {
+		world[y] = make([]uint8, io.params.ImageWidth)
+		for x := range world[y] {
+			world[y][x] = <-io.channels.output
+		}
+	}
+	return world
+}
+
+// sendWorld answers a successful read and sends the board to the distributor as an array of bytes.
+func (io *ioState) sendWorld(world [][]uint8) {
+	io.channels.errors <- nil
+	for _, row := range world {
+		for _, b := range row {
+			io.channels.input <- b
+		}
+	}
+}
 
+// writePgmImage receives an array of bytes and writes it to a pgm file (P2 if Params.Plain is
+// set), followed by the export formats. Each cell is snapped to the level of its state under the rule.
+// The whole board is received before anything is written, so the distributor is never left blocked.
+func (io *ioState) writePgmImage() {
 	// Request a filename from the distributor.
 	filename := <-io.channels.filename
 
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	util.Check(ioError)
-	defer file.Close()
-
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
-
-	world := make([][]byte, io.params.ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, io.params.ImageWidth)
-	}
-
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			val := <-io.channels.output
-			//if val != 0 {
-			//	fmt.Println(x, y)
-			//}
-			world[y][x] = val
+	world := io.receiveWorld()
+	for _, row := range world {
+		for x, cell := range row {
+			row[x] = io.params.Rule.Level(io.params.Rule.State(cell))
 		}
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
+	dir := io.params.outputDir()
+	path := filepath.Join(dir, filename)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		io.channels.errors <- err
+		return
+	}
+	magic := "P5"
+	if io.params.Plain {
+		magic = "P2"
+	}
+	if err := writePnmFile(path+".pgm", world, magic); err != nil {
+		io.channels.errors <- err
+		return
+	}
+	for _, format := range io.params.Export {
+		if err := writeExport(format, path, world, io.params); err != nil {
+			io.channels.errors <- err
+			return
 		}
 	}
-
-	ioError = file.Sync()
-	util.Check(ioError)
-
-	//fmt.Println("File", filename, "output done!")
+	io.channels.errors <- nil
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
+// readPgmImage opens a pbm or pgm file and sends its data as an array of bytes.
 func (io *ioState) readPgmImage() {
 
-	// Request a filename from the distributor.
-	filename := <-io.channels.filename
+	// Request a path from the distributor.
+	path := <-io.channels.filename
 
-	data, ioError := os.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
+	world, err := readImageFile(path, io.params.ImageWidth, io.params.ImageHeight, io.params.Rule)
+	if err != nil {
+		io.channels.errors <- err
+		return
+	}
+	io.sendWorld(world)
+}
 
-	fields := strings.Fields(string(data))
+// readPattern opens a pattern file, places it on an otherwise dead board at
+// (PatternX, PatternY) and sends the board as an array of bytes.
+func (io *ioState) readPattern() {
 
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
-	}
+	// Request a path from the distributor.
+	path := <-io.channels.filename
 
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+	pat, err := readPatternFile(path, io.params.Rule, io.params.ImageWidth, io.params.ImageHeight)
+	if err != nil {
+		io.channels.errors <- err
+		return
 	}
-
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+	world, err := pat.place(io.params.ImageWidth, io.params.ImageHeight, io.params.PatternX, io.params.PatternY)
+	if err != nil {
+		io.channels.errors <- err
+		return
 	}
+	io.sendWorld(world)
+}
 
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
-	}
+// recordFrame receives an array of bytes and adds it to the GIF as the next frame.
+func (io *ioState) recordFrame() {
+	world := io.receiveWorld()
+	io.channels.errors <- io.recording.addFrame(world, io.params)
+}
 
-	image := []byte(fields[4])
+// writeRecording writes the frames recorded so far to a gif file.
+func (io *ioState) writeRecording() {
+	// Request a filename from the distributor.
+	filename := <-io.channels.filename
 
-	for _, b := range image {
-		io.channels.input <- b
+	dir := io.params.outputDir()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		io.channels.errors <- err
+		return
 	}
-
-	//fmt.Println("File", filename, "input done!")
+	io.channels.errors <- io.recording.save(filepath.Join(dir, filename+".gif"))
 }
 
 // startIo should be the entrypoint of the io goroutine.
@@ -138,6 +170,12 @@ func startIo(p Params, c ioChannels) {
 			io.readPgmImage()
 		case ioOutput:
 			io.writePgmImage()
+		case ioPatternInput:
+			io.readPattern()
+		case ioFrame:
+			io.recordFrame()
+		case ioRecordingOutput:
+			io.writeRecording()
 		case ioCheckIdle:
 			io.channels.idle <- true
 		}
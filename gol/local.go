@@ -0,0 +1,286 @@
+package gol
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// localStrip is the share of one turn computed by a single goroutine.
+type localStrip struct {
+	rows   [][]uint8
+	packed [][]uint64
+	cells  []util.Cell
+	levels []uint8
+}
+
+// splitRows divides height rows between threads goroutines, running f on each share and
+// waiting for them all.
+func splitRows(height, threads int, f func(i, start, end int)) {
+	numRows := height / threads
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		start, end := i*numRows, (i+1)*numRows
+		// final goroutine does the remaining rows
+		if i == threads-1 {
+			end = height
+		}
+		wg.Add(1)
+		go func(i, start, end int) {
+			defer wg.Done()
+			f(i, start, end)
+		}(i, start, end)
+	}
+	wg.Wait()
+}
+
+// stepLocal advances world one turn, splitting the rows between threads goroutines, each
+// with its share's entry in activity so that it only works out the tiles that can change.
+// It returns the new world along with every cell that changed and its new level.
+func stepLocal(p Params, world [][]uint8, activity []engine.Activity) ([][]uint8, []util.Cell, []uint8) {
+	threads := len(activity)
+	height := len(world)
+	above, below := p.Topology.Beyond(world[0], world[height-1])
+
+	strips := make([]localStrip, threads)
+	splitRows(height, threads, func(i, start, end int) {
+		top, bottom := above, below
+		if start > 0 {
+			top = world[start-1]
+		}
+		if end < height {
+			bottom = world[end]
+		}
+		strips[i].rows = activity[i].Step(world[start:end], top, bottom, p.ImageWidth, p.Rule, p.Topology)
+		if !activity[i].Still() {
+			strips[i].cells, strips[i].levels = engine.Diff(world[start:end], strips[i].rows, start)
+		}
+	})
+
+	newWorld := make([][]uint8, 0, height)
+	var cells []util.Cell
+	var levels []uint8
+	for _, s := range strips {
+		newWorld = append(newWorld, s.rows...)
+		cells = append(cells, s.cells...)
+		levels = append(levels, s.levels...)
+	}
+	return newWorld, cells, levels
+}
+
+// stepLocalPacked is stepLocal for a bit-packed board.
+func stepLocalPacked(p Params, board [][]uint64, activity []engine.Activity) ([][]uint64, []util.Cell, []uint8) {
+	threads := len(activity)
+	height := len(board)
+	above, below := p.Topology.BeyondPacked(board[0], board[height-1], p.ImageWidth)
+
+	strips := make([]localStrip, threads)
+	splitRows(height, threads, func(i, start, end int) {
+		top, bottom := above, below
+		if start > 0 {
+			top = board[start-1]
+		}
+		if end < height {
+			bottom = board[end]
+		}
+		strips[i].packed = activity[i].StepPacked(board[start:end], top, bottom, p.ImageWidth, p.Rule, p.Topology)
+		if !activity[i].Still() {
+			strips[i].cells, strips[i].levels = engine.DiffPacked(board[start:end], strips[i].packed, start)
+		}
+	})
+
+	newBoard := make([][]uint64, 0, height)
+	var cells []util.Cell
+	var levels []uint8
+	for _, s := range strips {
+		newBoard = append(newBoard, s.packed...)
+		cells = append(cells, s.cells...)
+		levels = append(levels, s.levels...)
+	}
+	return newBoard, cells, levels
+}
+
+func calculateAliveCells(world [][]uint8) []util.Cell {
+	aliveCells := make([]util.Cell, 0)
+	for y, row := range world {
+		for x, cell := range row {
+			if cell == 255 {
+				aliveCells = append(aliveCells, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	return aliveCells
+}
+
+// sendChanges tells the GUI which cells changed on the way to turn.
+func sendChanges(p Params, c distributorChannels, turn int, cells []util.Cell, levels []uint8) {
+	if len(cells) == 0 {
+		return
+	}
+	if p.Rule.States > 2 {
+		c.events <- CellsUpdated{CompletedTurns: turn, Cells: cells, Levels: levels}
+	} else {
+		c.events <- CellsFlipped{CompletedTurns: turn, Cells: cells}
+	}
+}
+
+// localPaused blocks until the user resumes or quits, or ctx is done, and reports whether the game should stop.
+func localPaused(ctx context.Context, p Params, c distributorChannels, turn int, world [][]uint8) bool {
+	c.events <- StateChange{turn, Paused}
+	for {
+		var key rune
+		select {
+		case <-ctx.Done():
+			return true
+		case k, ok := <-c.keyPresses:
+			if !ok {
+				return true
+			}
+			key = k
+		}
+		switch key {
+		case 's':
+			if err := saveGameState(p, c, turn, world); err != nil {
+				report(c, turn, "save", err)
+			}
+		case 'p':
+			c.events <- StateChange{turn, Executing}
+			return false
+		case 'q', 'k':
+			return true
+		}
+	}
+}
+
+// localDistributor runs the whole game inside this process, using p.Threads goroutines per turn.
+// It sends the same events as distributor, plus CellsFlipped and TurnComplete every turn.
+// There is no broker to restart from, so the board always comes from the input image.
+func localDistributor(ctx context.Context, p Params, c distributorChannels) error {
+	world, err := loadInitialState(p, c)
+	if err != nil {
+		return abort(c.events, "load", err)
+	}
+	threads := p.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	if threads > p.ImageHeight {
+		threads = p.ImageHeight
+	}
+	// each goroutine keeps track of which tiles of its share of the board are changing
+	activity := make([]engine.Activity, threads)
+
+	// the packed engine keeps the board bit-packed, only turning it into bytes to save or record it
+	var board [][]uint64
+	if p.Engine == Packed {
+		board = engine.Pack(world)
+	}
+	current := func() [][]uint8 {
+		if board != nil {
+			return engine.Unpack(board, p.ImageWidth)
+		}
+		return world
+	}
+
+	ticker := time.NewTicker(p.CountEvery)
+	defer ticker.Stop()
+
+	c.events <- StateChange{0, Executing}
+	turn := 0
+	recordTurn(&p, c, turn, world)
+	stopped := false
+	for turn < p.Turns && !stopped {
+		var cells []util.Cell
+		var levels []uint8
+		if board != nil {
+			board, cells, levels = stepLocalPacked(p, board, activity)
+		} else {
+			world, cells, levels = stepLocal(p, world, activity)
+		}
+		turn++
+		// the packed board is only unpacked for the turns the GIF records
+		if p.GifEvery > 0 && turn%p.GifEvery == 0 {
+			recordTurn(&p, c, turn, current())
+		}
+		sendChanges(p, c, turn, cells, levels)
+		c.events <- TurnComplete{turn}
+
+		select {
+		case <-ctx.Done():
+			stopped = true
+		case <-ticker.C:
+			if board != nil {
+				c.events <- AliveCellsCount{turn, engine.CountAlivePacked(board)}
+			} else {
+				c.events <- AliveCellsCount{turn, engine.CountAlive(world)}
+			}
+		case key := <-c.keyPresses:
+			stopped = localKey(ctx, p, c, key, turn, current)
+		default:
+		}
+	}
+	return finishLocal(ctx, p, c, turn, current())
+}
+
+// recordTurn adds the board at turn to the GIF, giving up on the recording if that fails.
+func recordTurn(p *Params, c distributorChannels, turn int, world [][]uint8) {
+	if err := recordFrame(*p, c, turn, world); err != nil {
+		report(c, turn, "record", err)
+		p.GifEvery = 0
+	}
+}
+
+// localKey acts on a key pressed while a game runs inside this process, and reports whether
+// the game should stop. world gives the board at turn; it is only asked for by the keys that use it.
+func localKey(ctx context.Context, p Params, c distributorChannels, key rune, turn int, world func() [][]uint8) bool {
+	switch key {
+	case 's':
+		if err := saveGameState(p, c, turn, world()); err != nil {
+			report(c, turn, "save", err)
+		}
+	case 'q', 'k':
+		// there is no broker to keep running, so k behaves like q
+		return true
+	case 'p':
+		return localPaused(ctx, p, c, turn, world())
+	}
+	return false
+}
+
+// saveFinal saves the final board and the GIF, reporting the first that fails. The board is
+// still reported if it cannot be saved, but Run returns the error.
+func saveFinal(p Params, c distributorChannels, turn int, world [][]uint8) error {
+	err := saveGameState(p, c, turn, world)
+	if err == nil {
+		err = saveRecording(p, c, turn)
+	}
+	if err != nil {
+		report(c, turn, "save", err)
+	}
+	return err
+}
+
+// finishLocal ends a game run inside this process that stopped at turn with world as its
+// board, and returns the error Run returns.
+func finishLocal(ctx context.Context, p Params, c distributorChannels, turn int, world [][]uint8) error {
+	var err error
+	if ctx.Err() != nil {
+		// a cancelled game has no final board
+		err = ctx.Err()
+	} else {
+		err = saveFinal(p, c, turn, world)
+		c.events <- FinalTurnComplete{
+			CompletedTurns: turn,
+			Alive:          calculateAliveCells(world),
+		}
+	}
+
+	c.ioCommand <- ioCheckIdle
+	<-c.ioIdle
+	c.events <- StateChange{turn, Quitting}
+	close(c.events)
+	return err
+}
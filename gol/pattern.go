@@ -0,0 +1,93 @@
+package gol
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+)
+
+// pattern is a rectangle of cells read from a pattern file, stored as grey levels like the board.
+type pattern struct {
+	width, height int
+	cells         [][]uint8
+}
+
+// readPatternFile reads a pattern file, choosing the format from its extension. width and
+// height are the size of the board the pattern is for.
+func readPatternFile(path string, rule engine.Rule, width, height int) (pattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return pattern{}, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".rle":
+		return readRle(file, rule, width, height)
+	case ".cells":
+		return readCells(file, rule)
+	case ".lif", ".life":
+		return readLife106(file, rule, width, height)
+	default:
+		return pattern{}, fmt.Errorf("%v: unknown pattern format", path)
+	}
+}
+
+// writeExport writes the board to path, plus the extension of one of the export formats.
+func writeExport(format, path string, world [][]uint8, p Params) error {
+	rule := p.Rule
+	var extension string
+	var write func(file *os.File) error
+	switch format {
+	case "rle":
+		extension = ".rle"
+		write = func(file *os.File) error { return writeRle(file, world, rule) }
+	case "cells":
+		extension = ".cells"
+		write = func(file *os.File) error { return writeCells(file, world, rule) }
+	case "life106":
+		extension = ".lif"
+		write = func(file *os.File) error { return writeLife106(file, world, rule) }
+	case "pbm":
+		extension = ".pbm"
+		magic := "P4"
+		if p.Plain {
+			magic = "P1"
+		}
+		write = func(file *os.File) error { return writePnm(file, world, magic) }
+	case "png":
+		extension = ".png"
+		write = func(file *os.File) error { return writePng(file, world, p) }
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	file, err := os.Create(path + extension)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// place puts a pattern on an empty width x height board with its top-left corner at (x, y).
+func (pat pattern) place(width, height, x, y int) ([][]uint8, error) {
+	if x < 0 || y < 0 || x+pat.width > width || y+pat.height > height {
+		return nil, fmt.Errorf("a %vx%v pattern at (%v, %v) does not fit on a %vx%v board",
+			pat.width, pat.height, x, y, width, height)
+	}
+	world := make([][]uint8, height)
+	for i := range world {
+		world[i] = make([]uint8, width)
+	}
+	for py, row := range pat.cells {
+		copy(world[y+py][x:], row)
+	}
+	return world, nil
+}
@@ -0,0 +1,136 @@
+package gol
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// gifDelay is how long each GIF frame is shown, in hundredths of a second.
+const gifDelay = 10
+
+// palettes map the grey level of a cell to the colour it is drawn in. Dying cells of a
+// Generations rule get the colours between dead (level 0) and alive (level 255).
+var palettes = map[string]func(level uint8) color.RGBA{
+	"grey": func(level uint8) color.RGBA {
+		return color.RGBA{R: level, G: level, B: level, A: 255}
+	},
+	"inverted": func(level uint8) color.RGBA {
+		return color.RGBA{R: 255 - level, G: 255 - level, B: 255 - level, A: 255}
+	},
+	"green": func(level uint8) color.RGBA {
+		return color.RGBA{G: level, A: 255}
+	},
+	"heat": func(level uint8) color.RGBA {
+		// dead cells are black, dying cells cool from red to dark red, alive cells are yellow
+		if level == 255 {
+			return color.RGBA{R: 255, G: 230, A: 255}
+		}
+		return color.RGBA{R: level, A: 255}
+	},
+}
+
+// Palettes lists the names accepted by Params.Palette.
+func Palettes() []string {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// palette returns the 256 colours of the named palette, indexed by grey level.
+// An empty name is the grey palette the PGM images use.
+func palette(name string) (color.Palette, error) {
+	if name == "" {
+		name = "grey"
+	}
+	colour, ok := palettes[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown palette %q: expected one of %v", name, strings.Join(Palettes(), ", "))
+	}
+	pal := make(color.Palette, 256)
+	for level := range pal {
+		pal[level] = colour(uint8(level))
+	}
+	return pal, nil
+}
+
+// picture draws the board with each cell as a scale by scale square of its palette colour.
+func picture(world [][]uint8, pal color.Palette, scale int) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	width := 0
+	if len(world) > 0 {
+		width = len(world[0])
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, len(world)*scale), pal)
+	for y, row := range world {
+		line := img.Pix[y*scale*img.Stride : y*scale*img.Stride+width*scale]
+		for x, cell := range row {
+			for i := 0; i < scale; i++ {
+				line[x*scale+i] = cell
+			}
+		}
+		// the other rows of the square are copies of the first
+		for i := 1; i < scale; i++ {
+			copy(img.Pix[(y*scale+i)*img.Stride:], line)
+		}
+	}
+	return img
+}
+
+// writePng writes the board as a PNG in the colours of Params.Palette, scaled by Params.Scale.
+func writePng(w io.Writer, world [][]uint8, p Params) error {
+	pal, err := palette(p.Palette)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, picture(world, pal, p.Scale))
+}
+
+// recording collects the frames of the animated GIF of a run.
+type recording struct {
+	pal  color.Palette
+	anim gif.GIF
+}
+
+// addFrame draws the board as the next frame of the GIF.
+func (r *recording) addFrame(world [][]uint8, p Params) error {
+	if r.pal == nil {
+		pal, err := palette(p.Palette)
+		if err != nil {
+			return err
+		}
+		r.pal = pal
+	}
+	r.anim.Image = append(r.anim.Image, picture(world, r.pal, p.Scale))
+	r.anim.Delay = append(r.anim.Delay, gifDelay)
+	return nil
+}
+
+// save writes the frames recorded so far to path and starts a new recording.
+func (r *recording) save(path string) error {
+	defer func() { r.anim = gif.GIF{} }()
+	if len(r.anim.Image) == 0 {
+		return nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(file, &r.anim); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,156 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+)
+
+// life106Header is the first line of every Life 1.06 file.
+const life106Header = "#Life 1.06"
+
+// readCells reads the plaintext .cells format: '!' comment lines followed by a grid of '.' for
+// dead and 'O' for alive cells. Rows may leave off trailing dead cells.
+func readCells(r io.Reader, rule engine.Rule) (pattern, error) {
+	var pat pattern
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		row := make([]uint8, len(line))
+		for x, ch := range []byte(line) {
+			switch ch {
+			case '.':
+			case 'O', '*':
+				row[x] = rule.Level(1)
+			default:
+				return pat, fmt.Errorf("cells: unexpected %q on row %v", ch, len(pat.cells))
+			}
+		}
+		pat.cells = append(pat.cells, row)
+		if len(row) > pat.width {
+			pat.width = len(row)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pat, err
+	}
+	// trailing blank lines are not part of the pattern
+	for len(pat.cells) > 0 && len(pat.cells[len(pat.cells)-1]) == 0 {
+		pat.cells = pat.cells[:len(pat.cells)-1]
+	}
+	if len(pat.cells) == 0 || pat.width == 0 {
+		return pat, fmt.Errorf("cells: no cells in pattern")
+	}
+	pat.height = len(pat.cells)
+	for y, row := range pat.cells {
+		pat.cells[y] = append(row, make([]uint8, pat.width-len(row))...)
+	}
+	return pat, nil
+}
+
+// writeCells writes the whole board in the .cells format. It only has alive and dead cells,
+// so the dying cells of a Generations rule are written as dead.
+func writeCells(w io.Writer, world [][]uint8, rule engine.Rule) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "!Rule: %v\n", rule)
+	for _, row := range world {
+		line := make([]byte, len(row))
+		for x, cell := range row {
+			line[x] = '.'
+			if rule.State(cell) == 1 {
+				line[x] = 'O'
+			}
+		}
+		out.Write(line)
+		out.WriteString("\n")
+	}
+	return out.Flush()
+}
+
+// readLife106 reads the Life 1.06 format: a "#Life 1.06" line followed by one "x y" line per
+// alive cell. Coordinates are kept as they are unless some are negative, in which case the
+// pattern is shifted just enough to bring them onto the board. A pattern that spans more than
+// the width by height board is turned down before room is made for its cells.
+func readLife106(r io.Reader, rule engine.Rule, width, height int) (pattern, error) {
+	var pat pattern
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != life106Header {
+		return pat, fmt.Errorf("life 1.06: first line must be %q", life106Header)
+	}
+
+	var xs, ys []int
+	minX, minY, maxX, maxY := 0, 0, 0, 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return pat, fmt.Errorf("life 1.06: expected \"x y\", got %q", line)
+		}
+		x, errX := strconv.Atoi(fields[0])
+		y, errY := strconv.Atoi(fields[1])
+		if errX != nil || errY != nil {
+			return pat, fmt.Errorf("life 1.06: expected \"x y\", got %q", line)
+		}
+		// the pattern spans 0 as well as every cell, so a cell this far out cannot fit
+		if x <= -width || x >= width || y <= -height || y >= height {
+			return pat, fmt.Errorf("life 1.06: cell %v %v does not fit on a %vx%v board", x, y, width, height)
+		}
+		if len(xs) == 0 || x > maxX {
+			maxX = x
+		}
+		if len(ys) == 0 || y > maxY {
+			maxY = y
+		}
+		if x < minX {
+			minX = x
+		}
+		if y < minY {
+			minY = y
+		}
+		xs, ys = append(xs, x), append(ys, y)
+	}
+	if err := scanner.Err(); err != nil {
+		return pat, err
+	}
+	if len(xs) == 0 {
+		return pat, fmt.Errorf("life 1.06: no cells in pattern")
+	}
+
+	pat.width, pat.height = maxX-minX+1, maxY-minY+1
+	if pat.width > width || pat.height > height {
+		return pat, fmt.Errorf("life 1.06: a %vx%v pattern does not fit on a %vx%v board", pat.width, pat.height, width, height)
+	}
+	pat.cells = make([][]uint8, pat.height)
+	for y := range pat.cells {
+		pat.cells[y] = make([]uint8, pat.width)
+	}
+	for i := range xs {
+		pat.cells[ys[i]-minY][xs[i]-minX] = rule.Level(1)
+	}
+	return pat, nil
+}
+
+// writeLife106 lists the alive cells of the board in the Life 1.06 format, row by row.
+// Like .cells, it cannot hold the dying cells of a Generations rule.
+func writeLife106(w io.Writer, world [][]uint8, rule engine.Rule) error {
+	out := bufio.NewWriter(w)
+	out.WriteString(life106Header + "\n")
+	for y, row := range world {
+		for x, cell := range row {
+			if rule.State(cell) == 1 {
+				fmt.Fprintf(out, "%v %v\n", x, y)
+			}
+		}
+	}
+	return out.Flush()
+}
@@ -0,0 +1,336 @@
+package gol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+)
+
+// pnmLineLength is the longest line written in the plain (ASCII) formats, as Netpbm requires.
+const pnmLineLength = 70
+
+// Errors found in the contents of an image. They reach the caller wrapped in an ImageError.
+var (
+	ErrUnsupported = errors.New("not a PBM or PGM image")
+	ErrHeader      = errors.New("invalid header")
+	ErrTruncated   = errors.New("image data ends early")
+	ErrPixel       = errors.New("invalid pixel value")
+)
+
+// ImageError is an image file that could not be read or written.
+type ImageError struct {
+	Path string
+	Err  error
+}
+
+func (e *ImageError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Path, e.Err)
+}
+
+func (e *ImageError) Unwrap() error {
+	return e.Err
+}
+
+// SizeError is an image that is not the size of the board it is loaded onto.
+type SizeError struct {
+	Width, Height           int
+	BoardWidth, BoardHeight int
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("image is %vx%v but the board is %vx%v", e.Width, e.Height, e.BoardWidth, e.BoardHeight)
+}
+
+// pnmReader streams the pixels of a PBM (P1, P4) or PGM (P2, P5) image a row at a time.
+type pnmReader struct {
+	r                     *bufio.Reader
+	magic                 string
+	width, height, maxval int
+}
+
+// newPnmReader reads the header of an image, leaving r at the first pixel.
+func newPnmReader(r io.Reader) (*pnmReader, error) {
+	pr := &pnmReader{r: bufio.NewReader(r), maxval: 1}
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(pr.r, magic); err != nil {
+		return nil, ErrUnsupported
+	}
+	pr.magic = string(magic)
+	if pr.magic != "P1" && pr.magic != "P2" && pr.magic != "P4" && pr.magic != "P5" {
+		return nil, ErrUnsupported
+	}
+
+	// header reads the next number of the header
+	header := func() (int, error) {
+		n, err := pr.number()
+		if err == io.EOF {
+			return 0, fmt.Errorf("%w: ends early", ErrHeader)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		return n, nil
+	}
+	var err error
+	if pr.width, err = header(); err != nil {
+		return nil, err
+	}
+	if pr.height, err = header(); err != nil {
+		return nil, err
+	}
+	if pr.width == 0 || pr.height == 0 {
+		return nil, fmt.Errorf("%w: %vx%v image", ErrHeader, pr.width, pr.height)
+	}
+	if pr.magic == "P2" || pr.magic == "P5" {
+		if pr.maxval, err = header(); err != nil {
+			return nil, err
+		}
+		if pr.maxval == 0 || pr.maxval > 65535 {
+			return nil, fmt.Errorf("%w: maxval %v", ErrHeader, pr.maxval)
+		}
+	}
+	return pr, nil
+}
+
+// skipSpace skips whitespace and '#' comments, returning the byte after them.
+func (pr *pnmReader) skipSpace() (byte, error) {
+	for {
+		b, err := pr.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case b == '#':
+			if _, err := pr.r.ReadString('\n'); err != nil {
+				return 0, err
+			}
+		case !isSpace(b):
+			return b, nil
+		}
+	}
+}
+
+// number reads a decimal number from the header or a plain image. The single whitespace byte
+// ending it is consumed, which is what separates the header of a raw image from its data.
+// It returns io.EOF if there is no number left.
+func (pr *pnmReader) number() (int, error) {
+	b, err := pr.skipSpace()
+	if err != nil {
+		return 0, err
+	}
+	n, digits := 0, 0
+	for ; err == nil && b >= '0' && b <= '9'; b, err = pr.r.ReadByte() {
+		n = n*10 + int(b-'0')
+		digits++
+		if n > 1<<24 {
+			return 0, fmt.Errorf("number too large")
+		}
+	}
+	switch {
+	case digits == 0:
+		return 0, fmt.Errorf("unexpected %q", b)
+	case err == io.EOF:
+		return n, nil
+	case err != nil:
+		return 0, err
+	case b == '#':
+		return n, pr.r.UnreadByte()
+	case !isSpace(b):
+		return 0, fmt.Errorf("unexpected %q", b)
+	}
+	return n, nil
+}
+
+// readRow reads the next row of pixels into row as grey levels, 255 being white for a PGM.
+// A black PBM pixel is an alive cell, so it reads as 255 too.
+func (pr *pnmReader) readRow(row []uint8) error {
+	switch pr.magic {
+	case "P1":
+		for x := range row {
+			b, err := pr.skipSpace()
+			if err != nil {
+				return truncated(err)
+			}
+			if b != '0' && b != '1' {
+				return fmt.Errorf("%w: unexpected %q", ErrPixel, b)
+			}
+			row[x] = 255 * (b - '0')
+		}
+	case "P2":
+		for x := range row {
+			v, err := pr.number()
+			if err == io.EOF {
+				return ErrTruncated
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrPixel, err)
+			}
+			if row[x], err = pr.level(v); err != nil {
+				return err
+			}
+		}
+	case "P4":
+		packed := make([]byte, (len(row)+7)/8)
+		if _, err := io.ReadFull(pr.r, packed); err != nil {
+			return truncated(err)
+		}
+		for x := range row {
+			row[x] = 255 * (packed[x/8] >> (7 - x%8) & 1)
+		}
+	case "P5":
+		size := 1
+		if pr.maxval > 255 {
+			size = 2
+		}
+		raw := make([]byte, len(row)*size)
+		if _, err := io.ReadFull(pr.r, raw); err != nil {
+			return truncated(err)
+		}
+		for x := range row {
+			v := int(raw[x])
+			if size == 2 {
+				v = int(raw[2*x])<<8 | int(raw[2*x+1])
+			}
+			var err error
+			if row[x], err = pr.level(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// level scales a sample to a grey level between 0 and 255.
+func (pr *pnmReader) level(v int) (uint8, error) {
+	if v > pr.maxval {
+		return 0, fmt.Errorf("%w: %v is above maxval %v", ErrPixel, v, pr.maxval)
+	}
+	return uint8((v*255 + pr.maxval/2) / pr.maxval), nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+// ImageSize reads the width and height from the header of a PBM or PGM image, so that a board
+// can be loaded without knowing its size in advance.
+func ImageSize(path string) (width, height int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	pr, err := newPnmReader(file)
+	if err != nil {
+		return 0, 0, &ImageError{Path: path, Err: err}
+	}
+	return pr.width, pr.height, nil
+}
+
+// readImageFile reads a width x height board from a PBM or PGM image. Grey levels are rounded
+// to the nearest state of the rule, so any greyscale image is a valid board.
+func readImageFile(path string, width, height int, rule engine.Rule) ([][]uint8, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pr, err := newPnmReader(file)
+	if err != nil {
+		return nil, &ImageError{Path: path, Err: err}
+	}
+	if pr.width != width || pr.height != height {
+		return nil, &ImageError{Path: path, Err: &SizeError{pr.width, pr.height, width, height}}
+	}
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = make([]uint8, width)
+		if err := pr.readRow(world[y]); err != nil {
+			return nil, &ImageError{Path: path, Err: err}
+		}
+		for x, v := range world[y] {
+			world[y][x] = rule.Level(rule.State(v))
+		}
+	}
+	return world, nil
+}
+
+// writePnm writes the board as an image in one of the formats P1, P2, P4 or P5.
+// The PBM formats only have alive and dead cells, so dying cells are written as dead.
+func writePnm(w io.Writer, world [][]uint8, magic string) error {
+	width := 0
+	if len(world) > 0 {
+		width = len(world[0])
+	}
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%v\n%v %v\n", magic, width, len(world))
+	if magic == "P2" || magic == "P5" {
+		out.WriteString("255\n")
+	}
+
+	for _, row := range world {
+		switch magic {
+		case "P1":
+			for x, cell := range row {
+				if x > 0 && x%pnmLineLength == 0 {
+					out.WriteByte('\n')
+				}
+				out.WriteByte('0' + cell/255)
+			}
+			out.WriteByte('\n')
+		case "P2":
+			line := 0
+			for x, cell := range row {
+				value := strconv.Itoa(int(cell))
+				if x > 0 && line+1+len(value) > pnmLineLength {
+					out.WriteByte('\n')
+					line = 0
+				} else if x > 0 {
+					out.WriteByte(' ')
+					line++
+				}
+				out.WriteString(value)
+				line += len(value)
+			}
+			out.WriteByte('\n')
+		case "P4":
+			packed := make([]byte, (width+7)/8)
+			for x, cell := range row {
+				packed[x/8] |= cell / 255 << (7 - x%8)
+			}
+			out.Write(packed)
+		case "P5":
+			out.Write(row)
+		default:
+			return fmt.Errorf("unknown image format %q", magic)
+		}
+	}
+	return out.Flush()
+}
+
+// writePnmFile writes the board to path as an image in one of the formats P1, P2, P4 or P5.
+func writePnmFile(path string, world [][]uint8, magic string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writePnm(file, world, magic); err != nil {
+		file.Close()
+		return &ImageError{Path: path, Err: err}
+	}
+	return file.Close()
+}
@@ -0,0 +1,214 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+)
+
+// rleLineLength is the longest body line written to an RLE file, as the format recommends.
+const rleLineLength = 70
+
+// readRle reads a run-length encoded pattern: '#' comment lines, an "x = , y = , rule =" header
+// and a body of runs ending in '!'. Two-state patterns use b/o for dead/alive; multi-state
+// patterns use '.' for dead and A, B, ... (then pA, pB, ...) for states 1, 2, ...
+// The rule in the header is checked but not applied: the board always runs under Params.Rule.
+// A pattern whose header makes it bigger than the width by height board is turned down
+// before room is made for its cells.
+func readRle(r io.Reader, rule engine.Rule, width, height int) (pattern, error) {
+	var pat pattern
+	scanner := bufio.NewScanner(r)
+	header := false
+	var body strings.Builder
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case !header:
+			if err := parseRleHeader(line, &pat); err != nil {
+				return pat, err
+			}
+			if pat.width > width || pat.height > height {
+				return pat, fmt.Errorf("rle: a %vx%v pattern does not fit on a %vx%v board", pat.width, pat.height, width, height)
+			}
+			header = true
+		default:
+			body.WriteString(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pat, err
+	}
+	if !header {
+		return pat, fmt.Errorf("rle: missing x = , y = header")
+	}
+
+	pat.cells = make([][]uint8, pat.height)
+	for y := range pat.cells {
+		pat.cells[y] = make([]uint8, pat.width)
+	}
+	// no run can be longer than the pattern is wide or tall, so digits past that are turned
+	// down before the count can overflow
+	longest := pat.width
+	if pat.height > longest {
+		longest = pat.height
+	}
+	x, y, count := 0, 0, 0
+	prefix := byte(0)
+	data := body.String()
+	for i := 0; i < len(data); i++ {
+		ch := data[i]
+		if ch >= '0' && ch <= '9' {
+			count = count*10 + int(ch-'0')
+			if count > longest {
+				return pat, fmt.Errorf("rle: a run of more than %v cells does not fit in the %vx%v pattern", longest, pat.width, pat.height)
+			}
+			continue
+		}
+		if ch >= 'p' && ch <= 'y' {
+			// states past X take a prefix letter: pA is state 25
+			prefix = ch
+			continue
+		}
+		run := count
+		if run == 0 {
+			run = 1
+		}
+		count = 0
+
+		state := -1
+		switch {
+		case ch == '!':
+			return pat, nil
+		case ch == '$':
+			x, y = 0, y+run
+			continue
+		case ch == 'b' || ch == '.':
+			state = 0
+		case ch == 'o':
+			state = 1
+		case ch >= 'A' && ch <= 'X':
+			state = int(ch-'A') + 1
+			if prefix != 0 {
+				state += 24 * int(prefix-'p'+1)
+				prefix = 0
+			}
+		default:
+			return pat, fmt.Errorf("rle: unexpected %q in pattern", ch)
+		}
+		if state >= rule.States {
+			return pat, fmt.Errorf("rle: state %v does not exist under %v", state, rule)
+		}
+		if x < 0 || y < 0 || x+run > pat.width || y >= pat.height {
+			return pat, fmt.Errorf("rle: cells outside the %vx%v pattern", pat.width, pat.height)
+		}
+		for ; run > 0; run-- {
+			pat.cells[y][x] = rule.Level(state)
+			x++
+		}
+	}
+	return pat, fmt.Errorf("rle: pattern does not end with '!'")
+}
+
+// parseRleHeader reads the "x = m, y = n, rule = r" line.
+func parseRleHeader(line string, pat *pattern) error {
+	for _, field := range strings.Split(line, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("rle: invalid header %q", line)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		var err error
+		switch key {
+		case "x":
+			pat.width, err = strconv.Atoi(value)
+		case "y":
+			pat.height, err = strconv.Atoi(value)
+		case "rule":
+			_, err = engine.ParseRule(value)
+		}
+		if err != nil {
+			return fmt.Errorf("rle: invalid header %q: %w", line, err)
+		}
+	}
+	if pat.width <= 0 || pat.height <= 0 {
+		return fmt.Errorf("rle: invalid header %q: x and y must be positive", line)
+	}
+	return nil
+}
+
+// rleSymbol is how a cell is written in an RLE body.
+func rleSymbol(state int, rule engine.Rule) string {
+	if rule.States == 2 {
+		if state == 1 {
+			return "o"
+		}
+		return "b"
+	}
+	switch {
+	case state == 0:
+		return "."
+	case state <= 24:
+		return string(rune('A' + state - 1))
+	default:
+		return string([]rune{rune('p' + (state-25)/24), rune('A' + (state-25)%24)})
+	}
+}
+
+// writeRle writes the whole board as an RLE pattern, so reading it back at offset (0, 0)
+// reproduces the board exactly.
+func writeRle(w io.Writer, world [][]uint8, rule engine.Rule) error {
+	out := bufio.NewWriter(w)
+	width := 0
+	if len(world) > 0 {
+		width = len(world[0])
+	}
+	fmt.Fprintf(out, "x = %v, y = %v, rule = %v\n", width, len(world), rule)
+
+	lineLength := 0
+	emit := func(run int, symbol string) {
+		token := symbol
+		if run > 1 {
+			token = strconv.Itoa(run) + symbol
+		}
+		if lineLength+len(token) > rleLineLength {
+			out.WriteString("\n")
+			lineLength = 0
+		}
+		out.WriteString(token)
+		lineLength += len(token)
+	}
+
+	pendingRows := 0
+	for _, row := range world {
+		// trailing dead cells are left off each row
+		end := len(row)
+		for end > 0 && rule.State(row[end-1]) == 0 {
+			end--
+		}
+		if end == 0 {
+			pendingRows++
+			continue
+		}
+		if pendingRows > 0 {
+			emit(pendingRows, "$")
+		}
+		pendingRows = 1
+		for x := 0; x < end; {
+			state := rule.State(row[x])
+			run := 1
+			for x+run < end && rule.State(row[x+run]) == state {
+				run++
+			}
+			emit(run, rleSymbol(state, rule))
+			x += run
+		}
+	}
+	emit(1, "!")
+	out.WriteString("\n")
+	return out.Flush()
+}
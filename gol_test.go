@@ -42,3 +42,37 @@ func TestGol(t *testing.T) {
 		}
 	}
 }
+
+// TestGolNonSquare tests 128x64 and 64x128 images on 0, 1 and 100 turns using 1-16 worker threads.
+func TestGolNonSquare(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 128, ImageHeight: 64},
+		{ImageWidth: 64, ImageHeight: 128},
+	}
+	for _, p := range tests {
+		for _, turns := range []int{0, 1, 100} {
+			p.Turns = turns
+			expectedAlive := readAliveCells(
+				"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			for threads := 1; threads <= 16; threads++ {
+				p.Threads = threads
+				testName := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+				t.Run(testName, func(t *testing.T) {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					var cells []util.Cell
+					for event := range events {
+						switch e := event.(type) {
+						case gol.FinalTurnComplete:
+							cells = e.Alive
+						}
+					}
+					assertEqualBoard(t, cells, expectedAlive, p)
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestHashLife tests the HashLife engine on 16x16, 64x64 and 512x512 images on 0, 1 and 100
+// turns, a glider crossing a 64x64 torus, which it does every 256 turns, and so is back where it
+// started after a billion turns, and that boards HashLife cannot run are turned down.
+func TestHashLife(t *testing.T) {
+	var tests []boardTest
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			tests = append(tests, boardTest{
+				name:   fmt.Sprintf("%dx%dx%d", size, size, turns),
+				params: gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns, Engine: gol.HashLife},
+			})
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "glider.cells")
+	if err := os.WriteFile(path, []byte("!Name: Glider\n.O.\n..O\nOOO\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests,
+		boardTest{
+			name: "glider",
+			params: gol.Params{
+				ImageWidth:  64,
+				ImageHeight: 64,
+				Turns:       1000000000,
+				Engine:      gol.HashLife,
+				Pattern:     path,
+				PatternX:    10,
+				PatternY:    20,
+			},
+			expected: []util.Cell{{X: 11, Y: 20}, {X: 12, Y: 21}, {X: 10, Y: 22}, {X: 11, Y: 22}, {X: 12, Y: 22}},
+			within:   10 * time.Second,
+		},
+		boardTest{
+			name:    "128x64",
+			params:  gol.Params{ImageWidth: 128, ImageHeight: 64, Turns: 10, Engine: gol.HashLife},
+			failure: "params",
+		},
+	)
+	runBoardTests(t, tests)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestInput tests a board loaded from an explicit image path, with its size read from the
+// file, and written under a directory and name template of its own.
+func TestInput(t *testing.T) {
+	p := gol.Params{
+		Turns:   100,
+		Threads: 4,
+		Input:   "images/64x64.pgm",
+		OutDir:  filepath.Join(t.TempDir(), "runs"),
+		OutName: "{name}-{turns}",
+	}
+	width, height, err := gol.ImageSize(p.Input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 64 || height != 64 {
+		t.Fatalf("ERROR: image size is %vx%v, expected 64x64", width, height)
+	}
+
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var cells []util.Cell
+	var filename string
+	for event := range events {
+		switch e := event.(type) {
+		case gol.ImageOutputComplete:
+			filename = e.Filename
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+
+	p.ImageWidth, p.ImageHeight = width, height
+	assertEqualBoard(t, cells, readAliveCells("check/images/64x64x100.pgm", width, height), p)
+	if filename != "64x64-100" {
+		t.Errorf("ERROR: image written as %q, expected %q", filename, "64x64-100")
+	}
+	written := readAliveCells(filepath.Join(p.OutDir, "64x64-100.pgm"), width, height)
+	assertEqualBoard(t, written, cells, p)
+}
@@ -15,6 +15,7 @@ func TestKeyboard(t *testing.T) {
 	t.Run("q", testKeyboardQ)
 	t.Run("p+s", testKeyboardPS)
 	t.Run("p+q", testKeyboardPQ)
+	t.Run("p+s+p", testKeyboardPSP)
 }
 
 func testKeyboardP(t *testing.T) {
@@ -211,3 +212,48 @@ func testKeyboardPQ(t *testing.T) {
 
 	tester.Loop()
 }
+
+// testKeyboardPSP pauses and resumes several times, saving the board at each pause,
+// to check that every pause and snapshot is answered however often they are asked for.
+func testKeyboardPSP(t *testing.T) {
+	params := gol.Params{
+		Turns:       100000000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+	}
+
+	keyPresses := make(chan rune, 10)
+	events := make(chan gol.Event, 1000)
+
+	golDone := make(chan bool, 1)
+
+	go func() {
+		gol.Run(params, events, keyPresses)
+		golDone <- true
+	}()
+
+	tester := MakeTester(t, params, keyPresses, events, golDone)
+
+	go func() {
+		tester.TestStartsExecuting()
+
+		for i := 0; i < 3; i++ {
+			time.Sleep(250 * time.Millisecond)
+
+			keyPresses <- 'p'
+			turn := tester.TestPauses()
+
+			keyPresses <- 's'
+			tester.TestOutput()
+
+			keyPresses <- 'p'
+			tester.TestExecutes(turn)
+		}
+
+		keyPresses <- 'q'
+		tester.Stop(false)
+	}()
+
+	tester.Loop()
+}
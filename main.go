@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"runtime"
+	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"syscall"
 
 	"uk.ac.bris.cs/gameoflife/gol"
@@ -41,6 +45,114 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	flag.StringVar(
+		&params.Server,
+		"server",
+		gol.DefaultServer,
+		"Specify the broker address as host:port. Defaults to "+gol.DefaultServer+".")
+
+	flag.DurationVar(
+		&params.Timeout,
+		"timeout",
+		gol.DefaultTimeout,
+		"Specify how long to wait for the broker to answer a request before giving up on it. Defaults to "+gol.DefaultTimeout.String()+".")
+
+	flag.DurationVar(
+		&params.CountEvery,
+		"count",
+		gol.DefaultCountEvery,
+		"Specify how often the number of alive cells is reported. Defaults to "+gol.DefaultCountEvery.String()+".")
+
+	flag.StringVar(
+		&params.Session,
+		"session",
+		"",
+		"Name this run on the broker, keeping it apart from other controllers' runs. Defaults to a new random name.")
+
+	flag.BoolVar(
+		&params.Restart,
+		"restart",
+		false,
+		"Resume the session's last checkpoint on the broker instead of the input image. Needs -session.")
+
+	flag.Var(
+		&params.Rule,
+		"rule",
+		"Specify the Life-like rule as a B/S rulestring, e.g. B36/S23, or a Generations rule with a state count, e.g. B2/S/C3. Defaults to B3/S23.")
+
+	flag.Var(
+		&params.Topology,
+		"topology",
+		"Specify what lies beyond the edges of the board: torus, dead, reflect or klein. Defaults to torus.")
+
+	flag.Var(
+		&params.Mode,
+		"mode",
+		"Choose where to compute the game: auto, local or distributed. Auto uses the broker when it is reachable.")
+
+	flag.Var(
+		&params.Engine,
+		"engine",
+		"Choose how turns are computed: brute, packed for bit-packed boards with two-state rules, or hashlife for long runs on square power-of-two boards. Defaults to brute.")
+
+	flag.StringVar(
+		&params.Pattern,
+		"pattern",
+		"",
+		"Start from a pattern file (.rle, .cells or Life 1.06 .lif) instead of images/WxH.pgm.")
+
+	flag.IntVar(
+		&params.PatternX,
+		"patternX",
+		0,
+		"Specify the column the pattern's top-left corner is placed at. Defaults to 0.")
+
+	flag.IntVar(
+		&params.PatternY,
+		"patternY",
+		0,
+		"Specify the row the pattern's top-left corner is placed at. Defaults to 0.")
+
+	export := flag.String(
+		"export",
+		"",
+		"Comma-separated formats to write alongside every PGM image: rle, cells, life106, pbm or png.")
+
+	flag.BoolVar(
+		&params.Plain,
+		"plain",
+		false,
+		"Write PGM and PBM images in their plain (ASCII) formats, P2 and P1.")
+
+	flag.IntVar(
+		&params.Scale,
+		"scale",
+		1,
+		"Specify how many pixels wide each cell is in PNG and GIF output. Defaults to 1.")
+
+	flag.StringVar(
+		&params.Palette,
+		"palette",
+		"grey",
+		"Specify the colours of PNG and GIF output: "+strings.Join(gol.Palettes(), ", ")+". Defaults to grey.")
+
+	flag.IntVar(
+		&params.GifEvery,
+		"gif",
+		0,
+		"Record every Nth turn into an animated GIF written to out/ when the run ends. Defaults to 0, recording nothing.")
+
+	flag.StringVar(
+		&params.Input,
+		"input",
+		"",
+		"Start from this PGM or PBM image instead of images/WxH.pgm. Its size is read from the file, overriding -w and -h.")
+
+	out := flag.String(
+		"out",
+		"out/{w}x{h}x{turns}",
+		"Specify where images are written, as a path template without the extension. {name} is the input or pattern file's name; {w}, {h} and {turns} are the size and turn.")
+
 	headless := flag.Bool(
 		"headless",
 		false,
@@ -48,17 +160,40 @@ func main() {
 
 	flag.Parse()
 
+	if *export != "" {
+		params.Export = strings.Split(*export, ",")
+	}
+	params.OutDir, params.OutName = filepath.Split(*out)
+	if params.Session == "" && !params.Restart {
+		params.Session = gol.NewSessionID()
+	}
+	if params.Input != "" {
+		width, height, err := gol.ImageSize(params.Input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		params.ImageWidth, params.ImageHeight = width, height
+	}
+
 	fmt.Printf("%-10v %v\n", "Threads", params.Threads)
 	fmt.Printf("%-10v %v\n", "Width", params.ImageWidth)
 	fmt.Printf("%-10v %v\n", "Height", params.ImageHeight)
 	fmt.Printf("%-10v %v\n", "Turns", params.Turns)
+	fmt.Printf("%-10v %v\n", "Server", params.Server)
+	fmt.Printf("%-10v %v\n", "Session", params.Session)
+	fmt.Printf("%-10v %v\n", "Rule", params.Rule)
+	fmt.Printf("%-10v %v\n", "Topology", params.Topology)
+	fmt.Printf("%-10v %v\n", "Mode", params.Mode)
+	fmt.Printf("%-10v %v\n", "Engine", params.Engine)
 
 	keyPresses := make(chan rune, 10)
 	events := make(chan gol.Event, 1000)
 
-	go sigterm(keyPresses)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sigterm(keyPresses, cancel)
 
-	go gol.Run(params, events, keyPresses)
+	go gol.RunContext(ctx, params, events, keyPresses)
 	if !(*headless) {
 		sdl.Run(params, events, keyPresses)
 	} else {
@@ -66,9 +201,13 @@ func main() {
 	}
 }
 
-func sigterm(keyPresses chan<- rune) {
+// sigterm quits the game on the first signal, saving the board, and cancels it on the
+// second, for when the broker has stopped answering.
+func sigterm(keyPresses chan<- rune, cancel context.CancelFunc) {
 	sigterm := make(chan os.Signal, 1)
 	signal.Notify(sigterm, syscall.SIGTERM, syscall.SIGINT)
 	<-sigterm
 	keyPresses <- 'q'
+	<-sigterm
+	cancel()
 }
@@ -0,0 +1,119 @@
+// Package node implements the strip-holding RPC service that workers expose to the broker.
+// The broker also serves it in-process when it has to compute strips itself.
+package node
+
+import (
+	"errors"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// strip is the part of the board held for one run. A packed strip keeps its cells in packed
+// and leaves rows empty. activity lets each turn skip the tiles that cannot change, and alive
+// is only counted again when something did.
+type strip struct {
+	mu       sync.Mutex
+	rows     [][]uint8
+	packed   [][]uint64
+	start    int
+	width    int
+	rule     engine.Rule
+	topology engine.Topology
+	activity engine.Activity
+	alive    int
+}
+
+// Store keeps the strips of every run this node is taking part in.
+type Store struct {
+	mu     sync.Mutex
+	strips map[string]*strip
+}
+
+func NewStore() *Store {
+	return &Store{strips: make(map[string]*strip)}
+}
+
+func (s *Store) get(job string) (*strip, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.strips[job]
+	if !ok {
+		return nil, errors.New("unknown job " + job)
+	}
+	return st, nil
+}
+
+func (s *Store) LoadStrip(req stubs.WorkerRequest, _ *stubs.EmptyRes) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.strips[req.Job] = &strip{rows: req.Strip, packed: req.Packed, start: req.Start, width: req.Width, rule: req.Rule.OrDefault(), topology: req.Topology}
+	return nil
+}
+
+func (s *Store) StepStrip(req stubs.HaloRequest, res *stubs.HaloResponse) error {
+	st, err := s.get(req.Job)
+	if err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.packed != nil {
+		st.stepPacked(req, res)
+		return nil
+	}
+	old := st.rows
+	st.rows = st.activity.Step(st.rows, req.Top, req.Bottom, st.width, st.rule, st.topology)
+	res.Still = st.activity.Still()
+	if req.Flips && !res.Still {
+		res.Cells, res.Levels = engine.Diff(old, st.rows, st.start)
+	}
+	if !res.Still {
+		st.alive = engine.CountAlive(st.rows)
+	}
+	res.Top = st.rows[0]
+	res.Bottom = st.rows[len(st.rows)-1]
+	res.AliveCount = st.alive
+	return nil
+}
+
+func (s *Store) FetchStrip(req stubs.StripRequest, res *stubs.WorkerResponse) error {
+	st, err := s.get(req.Job)
+	if err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	res.Segment = st.rows
+	res.Packed = st.packed
+	return nil
+}
+
+// stepPacked is StepStrip for a packed strip. It is called with st.mu held.
+func (st *strip) stepPacked(req stubs.HaloRequest, res *stubs.HaloResponse) {
+	old := st.packed
+	st.packed = st.activity.StepPacked(st.packed, req.PackedTop, req.PackedBottom, st.width, st.rule, st.topology)
+	res.Still = st.activity.Still()
+	if req.Flips && !res.Still {
+		res.Cells, res.Levels = engine.DiffPacked(old, st.packed, st.start)
+	}
+	if !res.Still {
+		st.alive = engine.CountAlivePacked(st.packed)
+	}
+	res.PackedTop = st.packed[0]
+	res.PackedBottom = st.packed[len(st.packed)-1]
+	res.AliveCount = st.alive
+}
+
+func (s *Store) ReleaseStrip(req stubs.StripRequest, _ *stubs.EmptyRes) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.strips, req.Job)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestPacked tests the packed engine on 16x16, 64x64 and 512x512 images on 0, 1 and 100 turns,
+// on a 128x64 image after 100 turns on each bounded topology, and that it turns down Generations rules.
+func TestPacked(t *testing.T) {
+	var tests []boardTest
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			tests = append(tests, boardTest{
+				name:   fmt.Sprintf("%dx%dx%d", size, size, turns),
+				params: gol.Params{ImageWidth: size, ImageHeight: size, Turns: turns, Threads: 4, Engine: gol.Packed},
+			})
+		}
+	}
+	for _, topology := range []engine.Topology{engine.Dead, engine.Reflect, engine.Klein} {
+		tests = append(tests, boardTest{
+			name:   fmt.Sprintf("128x64x100-%v", topology),
+			params: gol.Params{ImageWidth: 128, ImageHeight: 64, Turns: 100, Threads: 4, Topology: topology, Engine: gol.Packed},
+		})
+	}
+
+	rule, err := engine.ParseRule("B2/S/C3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests, boardTest{
+		name:    "generations",
+		params:  gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: 1, Rule: rule, Engine: gol.Packed},
+		failure: "params",
+	})
+	runBoardTests(t, tests)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestPicture tests the PNG of the final board and the GIF of every other turn of a glider,
+// drawn three pixels to a cell in the inverted palette.
+func TestPicture(t *testing.T) {
+	p := gol.Params{
+		Turns:       8,
+		Threads:     4,
+		ImageWidth:  16,
+		ImageHeight: 16,
+		Pattern:     "patterns/glider.rle",
+		PatternX:    5,
+		PatternY:    5,
+		Export:      []string{"png"},
+		Scale:       3,
+		Palette:     "inverted",
+		GifEvery:    2,
+	}
+
+	emptyOutFolder()
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	for range events {
+	}
+
+	file, err := os.Open("out/16x16x8.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 48 || size.Y != 48 {
+		t.Fatalf("ERROR: PNG is %vx%v, expected 48x48", size.X, size.Y)
+	}
+	// after 8 turns the glider has moved two cells down and right, so (8, 7) is alive
+	black, white := color.Gray{Y: 0}, color.Gray{Y: 255}
+	for _, pixel := range []struct {
+		x, y     int
+		expected color.Gray
+	}{{8*3 + 1, 7*3 + 2, black}, {7*3 + 1, 6*3 + 1, white}, {0, 0, white}} {
+		got := color.GrayModel.Convert(img.At(pixel.x, pixel.y)).(color.Gray)
+		if got != pixel.expected {
+			t.Errorf("ERROR: PNG pixel (%v, %v) is %v, expected %v", pixel.x, pixel.y, got, pixel.expected)
+		}
+	}
+
+	file, err = os.Open("out/16x16x8.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// turns 0, 2, 4, 6 and 8
+	if len(anim.Image) != 5 {
+		t.Errorf("ERROR: GIF has %v frames, expected 5", len(anim.Image))
+	}
+	for i, frame := range anim.Image {
+		if size := frame.Bounds().Size(); size.X != 48 || size.Y != 48 {
+			t.Errorf("ERROR: GIF frame %v is %vx%v, expected 48x48", i, size.X, size.Y)
+		}
+	}
+}
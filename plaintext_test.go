@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPlaintext tests that .cells and Life 1.06 gliders placed on the 16x16 board move one
+// cell diagonally every 4 turns, and that the final board is exported in the same format.
+func TestPlaintext(t *testing.T) {
+	gliderCells := "!Rule: B3/S23\n"
+	for y := 0; y < 16; y++ {
+		switch y {
+		case 6:
+			gliderCells += ".......O........\n"
+		case 7:
+			gliderCells += "........O.......\n"
+		case 8:
+			gliderCells += "......OOO.......\n"
+		default:
+			gliderCells += "................\n"
+		}
+	}
+	tests := []struct {
+		pattern  string
+		format   string
+		exported string
+		expected string
+	}{
+		{"patterns/glider.cells", "cells", "out/16x16x4.cells", gliderCells},
+		{"patterns/glider.lif", "life106", "out/16x16x4.lif", "#Life 1.06\n7 6\n8 7\n6 8\n7 8\n8 8\n"},
+	}
+	expectedAlive := []util.Cell{{X: 7, Y: 6}, {X: 8, Y: 7}, {X: 6, Y: 8}, {X: 7, Y: 8}, {X: 8, Y: 8}}
+	for _, test := range tests {
+		p := gol.Params{
+			Turns:       4,
+			Threads:     4,
+			ImageWidth:  16,
+			ImageHeight: 16,
+			Pattern:     test.pattern,
+			PatternX:    5,
+			PatternY:    5,
+			Export:      []string{test.format},
+		}
+		t.Run(fmt.Sprintf("%v-%v", test.pattern, test.format), func(t *testing.T) {
+			emptyOutFolder()
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var cells []util.Cell
+			for event := range events {
+				switch e := event.(type) {
+				case gol.FinalTurnComplete:
+					cells = e.Alive
+				}
+			}
+			assertEqualBoard(t, cells, expectedAlive, p)
+
+			exported, err := os.ReadFile(test.exported)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(exported) != test.expected {
+				t.Errorf("ERROR: exported %v is\n%v\nexpected\n%v", test.format, string(exported), test.expected)
+			}
+		})
+	}
+}
+
+// TestLife106TooLarge tests that a Life 1.06 pattern spanning more than the board is turned
+// down, however far out its cells are.
+func TestLife106TooLarge(t *testing.T) {
+	dir := t.TempDir()
+	for name, cells := range map[string]string{
+		"wide":     "0 0\n16 0\n",
+		"across 0": "-8 0\n8 0\n",
+		"far":      "0 0\n20000 30000\n",
+		"huge":     "0 0\n9223372036854775807 -9223372036854775808\n",
+		"exact":    "-15 0\n0 -15\n0 0\n",
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".lif")
+		if err := os.WriteFile(path, []byte("#Life 1.06\n"+cells), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name, func(t *testing.T) {
+			p := gol.Params{Turns: 0, Threads: 4, ImageWidth: 16, ImageHeight: 16, Pattern: path, OutDir: t.TempDir()}
+			cells, _, err := runImage(p)
+			if name == "exact" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEqualBoard(t, cells, []util.Cell{{X: 0, Y: 15}, {X: 15, Y: 0}, {X: 15, Y: 15}}, p)
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "does not fit on a 16x16 board") {
+				t.Errorf("ERROR: expected a pattern bigger than the board to be turned down, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// glider is a glider on a 16x16 board, as the grid of a P1 image.
+func glider() [][]byte {
+	grid := make([][]byte, 16)
+	for y := range grid {
+		grid[y] = bytes.Repeat([]byte{'0'}, 16)
+	}
+	for _, cell := range []util.Cell{{X: 6, Y: 5}, {X: 7, Y: 6}, {X: 5, Y: 7}, {X: 6, Y: 7}, {X: 7, Y: 7}} {
+		grid[cell.Y][cell.X] = '1'
+	}
+	return grid
+}
+
+// pnmImages encodes the glider in every format the reader accepts. The raw PGM uses
+// whitespace bytes for dead cells and has comments in its header.
+func pnmImages() map[string][]byte {
+	images := map[string][]byte{}
+	var p1, p2, p4, p5, p5Wide bytes.Buffer
+	p1.WriteString("P1\n# a glider\n16 16\n")
+	p2.WriteString("P2 16\n16 # width then height\n1\n")
+	p4.WriteString("P4 16 16\n")
+	p5.WriteString("P5\n# dead cells are whitespace bytes\n16 16\n255\n")
+	p5Wide.WriteString("P5 16 16 1000\n")
+	dead := []byte{' ', '\n', '\t', '\r', 0}
+	for y, row := range glider() {
+		p1.Write(row)
+		p1.WriteString("\n")
+		packed := make([]byte, 2)
+		for x, ch := range row {
+			fmt.Fprintf(&p2, "%c ", ch)
+			if ch == '1' {
+				packed[x/8] |= 1 << (7 - x%8)
+				p5.WriteByte(255)
+				p5Wide.Write([]byte{1000 >> 8, 1000 & 0xff})
+			} else {
+				p5.WriteByte(dead[(x+y)%len(dead)])
+				p5Wide.Write([]byte{0, 3})
+			}
+		}
+		p2.WriteString("\n")
+		p4.Write(packed)
+	}
+	images["glider.p1.pbm"] = p1.Bytes()
+	images["glider.p2.pgm"] = p2.Bytes()
+	images["glider.p4.pbm"] = p4.Bytes()
+	images["glider.p5.pgm"] = p5.Bytes()
+	images["glider.wide.pgm"] = p5Wide.Bytes()
+	return images
+}
+
+// runImage runs p to completion, returning the final board, any ErrorOccurred and Run's error.
+func runImage(p gol.Params) ([]util.Cell, []gol.ErrorOccurred, error) {
+	events := make(chan gol.Event)
+	result := make(chan error, 1)
+	go func() { result <- gol.Run(p, events, nil) }()
+	var cells []util.Cell
+	var failures []gol.ErrorOccurred
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		case gol.ErrorOccurred:
+			failures = append(failures, e)
+		}
+	}
+	return cells, failures, <-result
+}
+
+// TestPnm tests that a glider moves one cell diagonally in 4 turns whichever PBM or PGM format
+// it is loaded from, and that plain images are written when asked for.
+func TestPnm(t *testing.T) {
+	dir := t.TempDir()
+	expected := []util.Cell{{X: 7, Y: 6}, {X: 8, Y: 7}, {X: 6, Y: 8}, {X: 7, Y: 8}, {X: 8, Y: 8}}
+	for name, data := range pnmImages() {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name, func(t *testing.T) {
+			p := gol.Params{Turns: 4, Threads: 4, Input: path, OutDir: t.TempDir(), Plain: true, Export: []string{"pbm"}}
+			cells, _, err := runImage(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.ImageWidth, p.ImageHeight = 16, 16
+			assertEqualBoard(t, cells, expected, p)
+
+			for file, header := range map[string]string{"16x16x4.pgm": "P2\n16 16\n255\n", "16x16x4.pbm": "P1\n16 16\n"} {
+				written, err := os.ReadFile(filepath.Join(p.OutDir, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(string(written), header) {
+					t.Errorf("ERROR: %v starts %q, expected %q", file, written[:len(header)], header)
+				}
+			}
+		})
+	}
+}
+
+// TestPnmErrors tests that images which cannot be loaded end the game with an error
+// rather than crashing it.
+func TestPnmErrors(t *testing.T) {
+	dir := t.TempDir()
+	images := pnmImages()
+	files := map[string][]byte{
+		"truncated.pgm": images["glider.p5.pgm"][:100],
+		"picture.gif":   []byte("GIF89a"),
+		"header.pgm":    []byte("P5 16 sixteen 255\n"),
+		"maxval.pgm":    []byte("P2 2 1 1\n0 2\n"),
+		"glider.pgm":    images["glider.p5.pgm"],
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var sizeError *gol.SizeError
+	tests := []struct {
+		input  string
+		width  int
+		expect func(error) bool
+	}{
+		{"truncated.pgm", 0, func(err error) bool { return errors.Is(err, gol.ErrTruncated) }},
+		{"picture.gif", 0, func(err error) bool { return errors.Is(err, gol.ErrUnsupported) }},
+		{"header.pgm", 0, func(err error) bool { return errors.Is(err, gol.ErrHeader) }},
+		{"maxval.pgm", 0, func(err error) bool { return errors.Is(err, gol.ErrPixel) }},
+		{"glider.pgm", 32, func(err error) bool { return errors.As(err, &sizeError) }},
+		{"missing.pgm", 0, func(err error) bool { return errors.Is(err, fs.ErrNotExist) }},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.input, func(t *testing.T) {
+			p := gol.Params{Turns: 4, Threads: 4, Input: filepath.Join(dir, test.input), OutDir: t.TempDir()}
+			if test.width != 0 {
+				p.ImageWidth, p.ImageHeight = test.width, test.width
+			}
+			_, failures, err := runImage(p)
+			if !test.expect(err) {
+				t.Errorf("ERROR: Run returned %v", err)
+			}
+			if len(failures) != 1 || failures[0].Err != err {
+				t.Errorf("ERROR: expected one ErrorOccurred event with the returned error, got %v", failures)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRle tests that an RLE glider placed on the 16x16 board moves one cell diagonally every
+// 4 turns, and that the final board is exported as RLE.
+func TestRle(t *testing.T) {
+	p := gol.Params{
+		Turns:       4,
+		Threads:     4,
+		ImageWidth:  16,
+		ImageHeight: 16,
+		Pattern:     "patterns/glider.rle",
+		PatternX:    5,
+		PatternY:    5,
+		Export:      []string{"rle"},
+	}
+	expected := []util.Cell{{X: 7, Y: 6}, {X: 8, Y: 7}, {X: 6, Y: 8}, {X: 7, Y: 8}, {X: 8, Y: 8}}
+
+	emptyOutFolder()
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	assertEqualBoard(t, cells, expected, p)
+
+	exported, err := os.ReadFile("out/16x16x4.rle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRle := "x = 16, y = 16, rule = B3/S23\n6$7bo$8bo$6b3o!\n"
+	if string(exported) != expectedRle {
+		t.Errorf("ERROR: exported RLE is\n%v\nexpected\n%v", string(exported), expectedRle)
+	}
+}
+
+// TestRleTooLarge tests that an RLE pattern whose header makes it bigger than the board is
+// turned down, however big the header says it is.
+func TestRleTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	for name, header := range map[string]string{
+		"wide":  "x = 17, y = 3",
+		"tall":  "x = 3, y = 17",
+		"huge":  "x = 2000000000, y = 2000000000",
+		"exact": "x = 16, y = 16",
+	} {
+		path := filepath.Join(dir, name+".rle")
+		if err := os.WriteFile(path, []byte(header+"\nbo$2bo$3o!\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name, func(t *testing.T) {
+			p := gol.Params{Turns: 0, Threads: 4, ImageWidth: 16, ImageHeight: 16, Pattern: path, OutDir: t.TempDir()}
+			cells, _, err := runImage(p)
+			if name == "exact" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEqualBoard(t, cells, []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}, p)
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "does not fit on a 16x16 board") {
+				t.Errorf("ERROR: expected a pattern bigger than the board to be turned down, got %v", err)
+			}
+		})
+	}
+}
+
+// TestRleBadRuns tests that runs too long for the pattern are turned down rather than
+// overflowing, however many digits they have.
+func TestRleBadRuns(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"overflow": "9223372036854775808$o!",
+		"long row": "17o!",
+		"long gap": "17$o!",
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".rle")
+		if err := os.WriteFile(path, []byte("x = 16, y = 16\n"+body+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name, func(t *testing.T) {
+			p := gol.Params{Turns: 0, Threads: 4, ImageWidth: 16, ImageHeight: 16, Pattern: path, OutDir: t.TempDir()}
+			_, _, err := runImage(p)
+			if err == nil || !strings.Contains(err.Error(), "rle: a run of more than 16 cells") {
+				t.Errorf("ERROR: expected a run longer than the pattern to be turned down, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRule tests that the rule in Params decides how the 16x16 image evolves.
+func TestRule(t *testing.T) {
+	everyCell := make([]util.Cell, 0, 16*16)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			everyCell = append(everyCell, util.Cell{X: x, Y: y})
+		}
+	}
+	rules := []struct {
+		rulestring string
+		turns      int
+		expected   []util.Cell
+	}{
+		{"B3/S23", 100, nil},
+		{"23/3", 100, nil},
+		{"B/S", 1, []util.Cell{}},
+		{"B012345678/S012345678", 1, everyCell},
+	}
+	var tests []boardTest
+	for _, r := range rules {
+		rule, err := engine.ParseRule(r.rulestring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests, boardTest{
+			name:     fmt.Sprintf("%v-%d", r.rulestring, r.turns),
+			params:   gol.Params{ImageWidth: 16, ImageHeight: 16, Turns: r.turns, Threads: 4, Rule: rule},
+			expected: r.expected,
+		})
+	}
+	runBoardTests(t, tests)
+}
+
+// readPlainPgm reads the levels of a P2 image.
+func readPlainPgm(t *testing.T, path string) [][]uint8 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 || fields[0] != "P2" {
+		t.Fatalf("%v is not a plain pgm file", path)
+	}
+	width, _ := strconv.Atoi(fields[1])
+	height, _ := strconv.Atoi(fields[2])
+	if len(fields) != 4+width*height {
+		t.Fatalf("%v has %v levels for a %vx%v image", path, len(fields)-4, width, height)
+	}
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = make([]uint8, width)
+		for x := range world[y] {
+			level, err := strconv.Atoi(fields[4+y*width+x])
+			if err != nil {
+				t.Fatal(err)
+			}
+			world[y][x] = uint8(level)
+		}
+	}
+	return world
+}
+
+// TestGenerationsImage tests that a Generations board keeps its dying cells on its way through
+// a PGM: levels read in round to the nearest state, the GUI is shown every level with
+// CellsUpdated, and the image written out is the board the GUI was shown, which reads back in as it was.
+func TestGenerationsImage(t *testing.T) {
+	rule, err := engine.ParseRule("B3/S23/C8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	// each level is read in as the one below it
+	levels := []uint8{0, 255, 250, 200, 150, 40, 1, 219, 110}
+	rounded := []uint8{0, 255, 219, 183, 146, 37, 37, 219, 110}
+
+	random := rand.New(rand.NewSource(1))
+	input := make([][]uint8, 16)
+	var text strings.Builder
+	text.WriteString("P2\n16 16\n255\n")
+	for y := range input {
+		input[y] = make([]uint8, 16)
+		for x := range input[y] {
+			i := random.Intn(len(levels))
+			input[y][x] = rounded[i]
+			fmt.Fprintf(&text, "%v\n", levels[i])
+		}
+	}
+	inputPath := filepath.Join(dir, "input.pgm")
+	if err := os.WriteFile(inputPath, []byte(text.String()), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// run plays turns from the image at path and returns the board the GUI was shown and the image written out
+	run := func(path string, turns int) (shown, written [][]uint8) {
+		p := gol.Params{
+			Turns:       turns,
+			Threads:     4,
+			ImageWidth:  16,
+			ImageHeight: 16,
+			Rule:        rule,
+			Mode:        gol.Local,
+			Input:       path,
+			OutDir:      dir,
+			Plain:       true,
+		}
+		shown = make([][]uint8, 16)
+		for y := range shown {
+			shown[y] = make([]uint8, 16)
+		}
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		for event := range events {
+			switch e := event.(type) {
+			case gol.CellsUpdated:
+				for i, cell := range e.Cells {
+					shown[cell.Y][cell.X] = e.Levels[i]
+				}
+			case gol.CellFlipped, gol.CellsFlipped:
+				t.Errorf("ERROR: expected a Generations board to be shown with CellsUpdated, got %v", event)
+			case gol.ErrorOccurred:
+				t.Fatal(e)
+			}
+		}
+		return shown, readPlainPgm(t, filepath.Join(dir, fmt.Sprintf("16x16x%v.pgm", turns)))
+	}
+
+	expected := input
+	for _, step := range []struct {
+		path  string
+		turns int
+	}{
+		{inputPath, 0},
+		{inputPath, 10},
+		{filepath.Join(dir, "16x16x10.pgm"), 5},
+	} {
+		if step.path == inputPath {
+			expected = input
+		}
+		for turn := 0; turn < step.turns; turn++ {
+			above, below := engine.Torus.Beyond(expected[0], expected[15])
+			expected = engine.Step(expected, above, below, 16, rule, engine.Torus)
+		}
+		shown, written := run(step.path, step.turns)
+		if !reflect.DeepEqual(shown, expected) {
+			t.Errorf("ERROR: %v turns from %v: the GUI was not shown the board", step.turns, filepath.Base(step.path))
+		}
+		if !reflect.DeepEqual(written, expected) {
+			t.Errorf("ERROR: %v turns from %v: the image written out is not the board", step.turns, filepath.Base(step.path))
+		}
+	}
+}
@@ -2,6 +2,7 @@ package sdl
 
 import (
 	"fmt"
+	"os"
 	"time"
 	"github.com/veandco/go-sdl2/sdl"
 	"uk.ac.bris.cs/gameoflife/gol"
@@ -57,6 +58,10 @@ sdl:
 				for _, cell := range e.Cells {
 					w.FlipPixel(cell.X, cell.Y) 
 				}
+			case gol.CellsUpdated:
+				for i, cell := range e.Cells {
+					w.SetPixelLevel(cell.X, cell.Y, e.Levels[i])
+				}
 			case gol.TurnComplete:
 				dirty = true
 			case gol.AliveCellsCount:
@@ -65,6 +70,9 @@ sdl:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 			case gol.ImageOutputComplete:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+			case gol.ErrorOccurred:
+				fmt.Fprintf(os.Stderr, "Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+				w.SetTitle("Game of Life - " + event.String())
 			case gol.StateChange:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 				if e.NewState == gol.Quitting {
@@ -85,6 +93,8 @@ func RunHeadless(events <-chan gol.Event) {
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), "Final Turn Complete")
 		case gol.ImageOutputComplete:
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
+		case gol.ErrorOccurred:
+			fmt.Fprintf(os.Stderr, "Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 		case gol.StateChange:
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 			if e.NewState == gol.Quitting {
@@ -54,6 +54,11 @@ func (w *Window) Destroy() {
 	sdl.Quit()
 }
 
+// SetTitle shows a message in the title bar, such as the last error.
+func (w *Window) SetTitle(title string) {
+	w.window.SetTitle(title)
+}
+
 func (w *Window) RenderFrame() {
 	err := w.texture.Update(nil, unsafe.Pointer(&w.pixels[0]), int(w.Width*4))
 	util.Check(err)
@@ -88,6 +93,24 @@ func (w *Window) FlipPixel(x, y int) {
 	w.pixels[4*(y*width+x)+3] = ^w.pixels[4*(y*width+x)+3]
 }
 
+// SetPixelLevel shades a pixel with a cell's grey level. Level 0 clears the pixel the same
+// way flipping an alive cell does, so CountPixels only ever counts alive cells.
+func (w *Window) SetPixelLevel(x, y int, level uint8) {
+	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
+		panic(fmt.Sprintf("CellsUpdated event at (%d, %d) is outside the bounds of the window.", x, y))
+	}
+
+	width := int(w.Width)
+	alpha := uint8(0xFF)
+	if level == 0 {
+		alpha = 0
+	}
+	w.pixels[4*(y*width+x)+0] = level
+	w.pixels[4*(y*width+x)+1] = level
+	w.pixels[4*(y*width+x)+2] = level
+	w.pixels[4*(y*width+x)+3] = alpha
+}
+
 func (w *Window) CountPixels() int {
 	count := 0
 	for i := 0; i < int(w.Width) * int(w.Height) * 4; i += 4 {
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+)
+
+var broker struct {
+	once    sync.Once
+	address string
+	err     error
+}
+
+// startBroker serves the broker's RPCs on a loopback port for the rest of the test binary and
+// returns its address. Its runs use the workers in members, or the broker's own node.
+func startBroker(t *testing.T) string {
+	broker.once.Do(func() {
+		var listener net.Listener
+		if broker.err = rpc.Register(&Server{}); broker.err != nil {
+			return
+		}
+		if listener, broker.err = net.Listen("tcp", "127.0.0.1:0"); broker.err != nil {
+			return
+		}
+		broker.address = listener.Addr().String()
+		go rpc.Accept(listener)
+	})
+	if broker.err != nil {
+		t.Fatal(broker.err)
+	}
+	return broker.address
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is the broker state written to disk so a run can resume after a crash.
+type Checkpoint struct {
+	Turn   int
+	Width  int
+	Height int
+	World  [][]uint8
+}
+
+// checkpointer decides when the running board is due to be written out.
+type checkpointer struct {
+	path     string
+	turns    int
+	interval time.Duration
+	lastTurn int
+	lastTime time.Time
+}
+
+// checkpoints holds the flags every session's checkpointer is copied from. Its path is the
+// directory the sessions' checkpoints are kept in.
+var checkpoints checkpointer
+
+// forSession returns a checkpointer writing to the session's own file in the checkpoint directory.
+func (c checkpointer) forSession(id string) checkpointer {
+	if c.path != "" {
+		c.path = filepath.Join(c.path, id+".gob")
+	}
+	return c
+}
+
+func (c *checkpointer) enabled() bool {
+	return c.path != "" && (c.turns > 0 || c.interval > 0)
+}
+
+// reset starts counting from the turn a run begins at.
+func (c *checkpointer) reset(turn int) {
+	c.lastTurn = turn
+	c.lastTime = time.Now()
+}
+
+func (c *checkpointer) due(turn int) bool {
+	if !c.enabled() {
+		return false
+	}
+	if c.turns > 0 && turn-c.lastTurn >= c.turns {
+		return true
+	}
+	return c.interval > 0 && time.Since(c.lastTime) >= c.interval
+}
+
+// save writes the checkpoint to a temporary file and renames it into place,
+// so a crash mid-write never leaves a truncated checkpoint behind.
+func (c *checkpointer) save(checkpoint Checkpoint) error {
+	c.reset(checkpoint.Turn)
+	if c.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(checkpoint); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// load reads the latest checkpoint, if there is one.
+func (c *checkpointer) load() (Checkpoint, bool, error) {
+	checkpoint := Checkpoint{}
+	if c.path == "" {
+		return checkpoint, false, nil
+	}
+	file, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return checkpoint, false, nil
+	}
+	if err != nil {
+		return checkpoint, false, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	defer file.Close()
+
+	if err := gob.NewDecoder(file).Decode(&checkpoint); err != nil {
+		return checkpoint, false, fmt.Errorf("reading checkpoint %v: %w", c.path, err)
+	}
+	return checkpoint, true, nil
+}
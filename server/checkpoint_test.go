@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestCheckpointSave tests that a checkpoint reads back as it was written, is renamed into
+// place without leaving its temporary file behind, and that a checkpointer with no path or
+// file to read is not an error.
+func TestCheckpointSave(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		// write is written to the path before loading, in place of a saved checkpoint
+		write  string
+		save   bool
+		found  bool
+		failed bool
+	}{
+		{name: "round trip", path: "session.gob", save: true, found: true},
+		{name: "nested directory", path: "a/b/session.gob", save: true, found: true},
+		{name: "overwrite", path: "session.gob", write: "old", save: true, found: true},
+		{name: "no path", save: true},
+		{name: "missing file", path: "session.gob"},
+		{name: "corrupt file", path: "session.gob", write: "not a checkpoint", failed: true},
+	}
+	checkpoint := Checkpoint{Turn: 7, Width: 3, Height: 2, World: [][]uint8{{0, 255, 0}, {255, 255, 0}}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			c := checkpointer{turns: 1}
+			if test.path != "" {
+				c.path = filepath.Join(dir, test.path)
+			}
+			if test.write != "" {
+				if err := os.WriteFile(c.path, []byte(test.write), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.save {
+				if err := c.save(checkpoint); err != nil {
+					t.Fatal(err)
+				}
+				if c.lastTurn != checkpoint.Turn {
+					t.Errorf("ERROR: expected saving to count from turn %v, got %v", checkpoint.Turn, c.lastTurn)
+				}
+			}
+
+			loaded, found, err := c.load()
+			if (err != nil) != test.failed {
+				t.Fatalf("ERROR: expected failure %v, got error %v", test.failed, err)
+			}
+			if found != test.found {
+				t.Fatalf("ERROR: expected found %v, got %v", test.found, found)
+			}
+			if found && !reflect.DeepEqual(loaded, checkpoint) {
+				t.Errorf("ERROR: expected %v, loaded %v", checkpoint, loaded)
+			}
+
+			err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && strings.Contains(info.Name(), ".tmp") {
+					t.Errorf("ERROR: temporary file %v left behind", path)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCheckpointDue(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		turns    int
+		interval time.Duration
+		// since is how long ago the last checkpoint was saved
+		since time.Duration
+		turn  int
+		due   bool
+	}{
+		{name: "disabled", turns: 0, turn: 100},
+		{name: "no path", turns: 10, turn: 100},
+		{name: "before turns", path: "c.gob", turns: 10, turn: 19},
+		{name: "at turns", path: "c.gob", turns: 10, turn: 20, due: true},
+		{name: "past turns", path: "c.gob", turns: 10, turn: 25, due: true},
+		{name: "before interval", path: "c.gob", interval: time.Minute, since: time.Second, turn: 11},
+		{name: "past interval", path: "c.gob", interval: time.Minute, since: 2 * time.Minute, turn: 11, due: true},
+		{name: "either", path: "c.gob", turns: 100, interval: time.Minute, since: 2 * time.Minute, turn: 11, due: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := checkpointer{path: test.path, turns: test.turns, interval: test.interval}
+			c.reset(10)
+			c.lastTime = c.lastTime.Add(-test.since)
+			if due := c.due(test.turn); due != test.due {
+				t.Errorf("ERROR: expected due %v at turn %v, got %v", test.due, test.turn, due)
+			}
+		})
+	}
+}
+
+func TestCheckpointForSession(t *testing.T) {
+	c := checkpointer{path: "checkpoints", turns: 5}
+	if path := c.forSession("alice").path; path != filepath.Join("checkpoints", "alice.gob") {
+		t.Errorf("ERROR: expected alice's checkpoint in checkpoints/alice.gob, got %v", path)
+	}
+	if c.path != "checkpoints" {
+		t.Errorf("ERROR: forSession changed the directory to %v", c.path)
+	}
+	if path := (checkpointer{}).forSession("alice").path; path != "" {
+		t.Errorf("ERROR: expected no checkpoint file without a directory, got %v", path)
+	}
+}
+
+// TestRestartMismatch tests that a board cannot be restarted from a checkpoint of another size.
+func TestRestartMismatch(t *testing.T) {
+	previous := checkpoints
+	checkpoints = checkpointer{path: t.TempDir(), turns: 1}
+	t.Cleanup(func() { checkpoints = previous })
+
+	c := checkpoints.forSession("restart-mismatch")
+	if err := c.save(Checkpoint{Turn: 3, Width: 16, Height: 16, World: randomBoard(16, 16, 3)}); err != nil {
+		t.Fatal(err)
+	}
+	req := stubs.Request{
+		Session:     "restart-mismatch",
+		Restart:     true,
+		Turns:       10,
+		ImageWidth:  32,
+		ImageHeight: 32,
+	}
+	err := new(Server).ProcessTurns(req, new(stubs.Response))
+	if err == nil || !strings.Contains(err.Error(), "cannot restart a 32x32 board from a 16x16 checkpoint") {
+		t.Errorf("ERROR: expected the size mismatch to be refused, got %v", err)
+	}
+}
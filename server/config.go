@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// workersEnv is the environment variable read when no -workers flag or -config file is given.
+const workersEnv = "GOL_WORKERS"
+
+// loadWorkerAddresses picks the worker list from the -workers flag, then the -config file,
+// then the GOL_WORKERS environment variable, and validates every address it finds.
+func loadWorkerAddresses(flagValue, configPath string) ([]string, error) {
+	var addresses []string
+	switch {
+	case flagValue != "":
+		addresses = splitAddresses(flagValue)
+	case configPath != "":
+		fromFile, err := readConfigFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		addresses = fromFile
+	default:
+		addresses = splitAddresses(os.Getenv(workersEnv))
+	}
+
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		if err := validateAddress(address); err != nil {
+			return nil, err
+		}
+		if seen[address] {
+			return nil, fmt.Errorf("worker address %v is listed twice", address)
+		}
+		seen[address] = true
+	}
+	return addresses, nil
+}
+
+func splitAddresses(list string) []string {
+	addresses := make([]string, 0)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			addresses = append(addresses, field)
+		}
+	}
+	return addresses
+}
+
+// readConfigFile reads one worker address per line, ignoring blank lines and # comments.
+func readConfigFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading worker config: %w", err)
+	}
+	defer file.Close()
+
+	addresses := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		addresses = append(addresses, splitAddresses(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading worker config %v: %w", path, err)
+	}
+	return addresses, nil
+}
+
+func validateAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid worker address %q: %w", address, err)
+	}
+	if host == "" {
+		return fmt.Errorf("invalid worker address %q: missing host", address)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("invalid worker address %q: bad port %q", address, port)
+	}
+	return nil
+}
+
+// probeWorkers reports every worker that cannot be reached right now. Workers may still be
+// starting up, so this only warns; the run itself fails if a worker stays unreachable.
+func probeWorkers(addresses []string) []error {
+	errs := make([]error, 0)
+	for _, address := range addresses {
+		conn, err := net.DialTimeout("tcp", address, 2*time.Second)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("worker %v unreachable: %w", address, err))
+			continue
+		}
+		conn.Close()
+	}
+	return errs
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestLoadWorkerAddresses tests that the -workers flag wins over the -config file, which wins
+// over GOL_WORKERS, and that every address found is checked whichever it came from.
+func TestLoadWorkerAddresses(t *testing.T) {
+	tests := []struct {
+		name string
+		flag string
+		// config, if set, is written to a file passed as the -config path
+		config    string
+		env       string
+		addresses []string
+		failed    bool
+	}{
+		{name: "flag wins", flag: "a:1, b:2", config: "c:3\n", env: "d:4", addresses: []string{"a:1", "b:2"}},
+		{name: "config wins", config: "c:3\n", env: "d:4", addresses: []string{"c:3"}},
+		{name: "env", env: "d:4,e:5", addresses: []string{"d:4", "e:5"}},
+		{name: "none", addresses: []string{}},
+		{
+			name:      "comments and blank lines",
+			config:    "# workers\n\na:1 # first\n  \nb:2, c:3\n#d:4\n",
+			addresses: []string{"a:1", "b:2", "c:3"},
+		},
+		{name: "duplicate in flag", flag: "a:1,a:1", failed: true},
+		{name: "duplicate in config", config: "a:1\nb:2\na:1\n", failed: true},
+		{name: "invalid port in flag", flag: "a:0", failed: true},
+		{name: "invalid port in config", config: "a:65536\n", failed: true},
+		{name: "invalid port in env", env: "a:http", failed: true},
+		{name: "invalid address overridden", flag: "a:1", env: "a:0", addresses: []string{"a:1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(workersEnv, test.env)
+			configPath := ""
+			if test.config != "" {
+				configPath = filepath.Join(t.TempDir(), "workers.conf")
+				if err := os.WriteFile(configPath, []byte(test.config), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			addresses, err := loadWorkerAddresses(test.flag, configPath)
+			if (err != nil) != test.failed {
+				t.Fatalf("ERROR: expected failure %v, got error %v", test.failed, err)
+			}
+			if !test.failed && !reflect.DeepEqual(addresses, test.addresses) {
+				t.Errorf("ERROR: expected %v, got %v", test.addresses, addresses)
+			}
+		})
+	}
+}
+
+// TestMissingConfig tests that a -config file that cannot be read is an error, rather than
+// falling back to GOL_WORKERS.
+func TestMissingConfig(t *testing.T) {
+	t.Setenv(workersEnv, "d:4")
+	if _, err := loadWorkerAddresses("", filepath.Join(t.TempDir(), "missing.conf")); err == nil {
+		t.Error("ERROR: expected a missing config file to be an error")
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		failed  bool
+	}{
+		{address: "localhost:8040"},
+		{address: "10.0.0.1:1"},
+		{address: "[::1]:65535"},
+		{address: "localhost", failed: true},
+		{address: ":8040", failed: true},
+		{address: "localhost:", failed: true},
+		{address: "localhost:0", failed: true},
+		{address: "localhost:65536", failed: true},
+		{address: "localhost:-1", failed: true},
+		{address: "localhost:http", failed: true},
+	}
+	for _, test := range tests {
+		if err := validateAddress(test.address); (err != nil) != test.failed {
+			t.Errorf("ERROR: %q: expected failure %v, got error %v", test.address, test.failed, err)
+		}
+	}
+}
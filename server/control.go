@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// runState is where a session's turn loop is. Only the loop moves a session out of idle and
+// back, but control requests move it between running and paused.
+type runState int
+
+const (
+	// stateIdle has no run in progress; requests are answered from the end of the last run.
+	stateIdle runState = iota
+	// stateRunning computes turns, answering requests between them.
+	stateRunning
+	// statePaused holds the turns, answering requests as they arrive. A session paused for a
+	// run that has not started yet begins that run paused.
+	statePaused
+	// stateCancelled ends the run after its first turn. Only a session cancelled for a run that
+	// has not started yet is in it.
+	stateCancelled
+)
+
+// commandKind is what a control RPC asks of a session.
+type commandKind int
+
+const (
+	countCommand commandKind = iota
+	snapshotCommand
+	pauseCommand
+	unpauseCommand
+	quitCommand
+)
+
+// command is a control request queued for the run loop, which answers it on reply.
+type command struct {
+	kind commandKind
+	// run is the stream of the run the request is for, or empty if the controller did not say.
+	run   string
+	reply chan commandReply
+}
+
+// commandReply is the answer to a command: the turn it was answered at and whatever else it asked for.
+type commandReply struct {
+	turn  int
+	alive int
+	world [][]uint8
+	err   error
+}
+
+// maxQueuedCommands bounds how many control requests can wait for a session's run loop.
+const maxQueuedCommands = 16
+
+// stopping is closed once the broker has been told to quit, ending every session's run.
+var stopping = make(chan bool)
+var stopOnce sync.Once
+
+func stop() {
+	stopOnce.Do(func() { close(stopping) })
+}
+
+func stopRequested() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// request carries out a control request for run on the session and returns the answer. While
+// a run is in progress its loop answers; otherwise the session answers straight away.
+func (s *session) request(kind commandKind, run string) commandReply {
+	s.control.Lock()
+	if !s.active {
+		defer s.control.Unlock()
+		return s.answerIdle(kind, run)
+	}
+	c := command{kind: kind, run: run, reply: make(chan commandReply, 1)}
+	select {
+	case s.commands <- c:
+	default:
+		s.control.Unlock()
+		return commandReply{err: fmt.Errorf("too many requests waiting for session %v", s.id)}
+	}
+	s.control.Unlock()
+	return <-c.reply
+}
+
+// answerIdle answers a request while no run is in progress. A pause or cancel for a run that
+// has not started yet is kept for it, so only that run begins paused or ends straight away.
+// It is called with s.control held.
+func (s *session) answerIdle(kind commandKind, run string) commandReply {
+	reply := commandReply{turn: s.turn, alive: s.alive}
+	switch {
+	case kind == snapshotCommand:
+		reply.err = errors.New("no run in progress")
+	case kind == pauseCommand && run == "":
+		reply.err = errors.New("no run in progress")
+	case kind == pauseCommand:
+		s.state, s.pending = statePaused, run
+	case kind == quitCommand && run != "":
+		s.state, s.pending = stateCancelled, run
+	case kind == unpauseCommand || kind == quitCommand:
+		s.state, s.pending = stateIdle, ""
+	}
+	return reply
+}
+
+// busy reports whether a run is in progress in the session.
+func (s *session) busy() bool {
+	s.control.Lock()
+	defer s.control.Unlock()
+
+	return s.active
+}
+
+// begin hands the session's requests to run, starting at turn with alive cells. A pause or
+// cancel kept for another run is dropped.
+func (s *session) begin(turn, alive int, run string) {
+	s.progress.start(turn, alive)
+
+	s.control.Lock()
+	defer s.control.Unlock()
+
+	s.active = true
+	s.turn = turn
+	if s.pending != run || s.state == stateIdle {
+		s.state = stateRunning
+	}
+	s.pending = ""
+}
+
+// end takes the session's requests back from a run that finished at turn with alive cells,
+// answering any the run left queued.
+func (s *session) end(turn, alive int) {
+	s.progress.finish(turn, alive)
+
+	s.control.Lock()
+	defer s.control.Unlock()
+
+	s.active = false
+	s.state = stateIdle
+	s.turn, s.alive = turn, alive
+	for {
+		select {
+		case c := <-s.commands:
+			c.reply <- s.answerIdle(c.kind, c.run)
+		default:
+			return
+		}
+	}
+}
+
+func (s *session) current() runState {
+	s.control.Lock()
+	defer s.control.Unlock()
+
+	return s.state
+}
+
+func (s *session) setState(state runState) {
+	s.control.Lock()
+	defer s.control.Unlock()
+
+	s.state = state
+}
+
+// serve answers the requests queued since the last turn and, while the session is paused,
+// waits for more. It reports whether the run should stop.
+func (s *session) serve(run *stripRun, turn int) bool {
+	for {
+		var c command
+		switch s.current() {
+		case stateCancelled:
+			return true
+		case statePaused:
+			select {
+			case c = <-s.commands:
+			case <-stopping:
+				return true
+			}
+		default:
+			select {
+			case c = <-s.commands:
+			default:
+				return false
+			}
+		}
+
+		reply := commandReply{turn: turn}
+		switch c.kind {
+		case countCommand:
+			reply.alive = run.aliveCount()
+		case snapshotCommand:
+			reply.world, _, reply.err = run.fetch()
+		case pauseCommand:
+			s.setState(statePaused)
+		case unpauseCommand:
+			s.setState(stateRunning)
+		}
+		c.reply <- reply
+		if c.kind == quitCommand {
+			return true
+		}
+	}
+}
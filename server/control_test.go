@@ -0,0 +1,280 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+func newControlSession(id string) *session {
+	return &session{id: id, commands: make(chan command, maxQueuedCommands)}
+}
+
+// startControlRun starts a run of a random board on the broker's own node in a new session,
+// as ProcessTurns does, but leaves stepping it and serving its requests to the test.
+func startControlRun(t *testing.T, id string) (*session, *stripRun) {
+	sess := newControlSession(id)
+	return sess, beginControlRun(t, sess, "")
+}
+
+// beginControlRun begins the run called stream in the session.
+func beginControlRun(t *testing.T, sess *session, stream string) *stripRun {
+	pool := newWorkerPool()
+	t.Cleanup(pool.close)
+	run, err := newStripRun(pool, randomBoard(16, 16, 4), 0, 16, 16, engine.Conway, engine.Torus, false, []string{localAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(run.release)
+	sess.begin(0, run.aliveCount(), stream)
+	return run
+}
+
+// ask makes a request of the session without waiting for the answer.
+func ask(sess *session, kind commandKind) <-chan commandReply {
+	replies := make(chan commandReply, 1)
+	go func() { replies <- sess.request(kind, "") }()
+	return replies
+}
+
+// waitQueued waits until n requests are queued for the session's run.
+func waitQueued(t *testing.T, sess *session, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sess.commands) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("ERROR: expected %v requests queued, %v are", n, len(sess.commands))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// answer waits for the answer to a request.
+func answer(t *testing.T, replies <-chan commandReply) commandReply {
+	t.Helper()
+	select {
+	case reply := <-replies:
+		return reply
+	case <-time.After(2 * time.Second):
+		t.Fatal("ERROR: a request was not answered")
+		return commandReply{}
+	}
+}
+
+// serveInBackground serves the session's requests on its own, as the run loop does between turns.
+func serveInBackground(sess *session, run *stripRun, turn int) <-chan bool {
+	stopped := make(chan bool, 1)
+	go func() { stopped <- sess.serve(run, turn) }()
+	return stopped
+}
+
+func expectState(t *testing.T, sess *session, state runState) {
+	t.Helper()
+	if current := sess.current(); current != state {
+		t.Errorf("ERROR: expected the session in state %v, got %v", state, current)
+	}
+}
+
+// TestControl tests the answers to control requests and the state they leave a session in,
+// before, during and after a run, paused and not.
+func TestControl(t *testing.T) {
+	t.Run("running", func(t *testing.T) {
+		sess, run := startControlRun(t, "control-running")
+		stepRun(t, run, 5)
+		count := ask(sess, countCommand)
+		waitQueued(t, sess, 1)
+		if sess.serve(run, 5) {
+			t.Fatal("ERROR: expected a count to leave the run going")
+		}
+		if reply := answer(t, count); reply.turn != 5 || reply.alive != run.aliveCount() || reply.err != nil {
+			t.Errorf("ERROR: expected %v alive cells at turn 5, got %+v", run.aliveCount(), reply)
+		}
+		expectState(t, sess, stateRunning)
+	})
+
+	t.Run("paused", func(t *testing.T) {
+		sess, run := startControlRun(t, "control-paused")
+		stepRun(t, run, 3)
+		pause := ask(sess, pauseCommand)
+		waitQueued(t, sess, 1)
+		stopped := serveInBackground(sess, run, 3)
+		if reply := answer(t, pause); reply.turn != 3 || reply.err != nil {
+			t.Errorf("ERROR: expected the pause at turn 3, got %+v", reply)
+		}
+		expectState(t, sess, statePaused)
+
+		// while paused, every request is answered as it arrives
+		if reply := answer(t, ask(sess, countCommand)); reply.turn != 3 || reply.alive != run.aliveCount() {
+			t.Errorf("ERROR: expected %v alive cells at turn 3 while paused, got %+v", run.aliveCount(), reply)
+		}
+		world, _, err := run.fetch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply := answer(t, ask(sess, snapshotCommand)); reply.turn != 3 || !reflect.DeepEqual(reply.world, world) {
+			t.Errorf("ERROR: expected the board at turn 3 while paused, got %+v", reply)
+		}
+		select {
+		case <-stopped:
+			t.Fatal("ERROR: expected a paused run to wait for more requests")
+		default:
+		}
+
+		answer(t, ask(sess, unpauseCommand))
+		if <-stopped {
+			t.Error("ERROR: expected an unpaused run to carry on")
+		}
+		expectState(t, sess, stateRunning)
+
+		// a second unpause leaves the run going
+		unpause := ask(sess, unpauseCommand)
+		waitQueued(t, sess, 1)
+		if sess.serve(run, 4) {
+			t.Error("ERROR: expected a second unpause to leave the run going")
+		}
+		if reply := answer(t, unpause); reply.turn != 4 || reply.err != nil {
+			t.Errorf("ERROR: expected the second unpause answered at turn 4, got %+v", reply)
+		}
+		expectState(t, sess, stateRunning)
+	})
+
+	t.Run("quit while paused", func(t *testing.T) {
+		sess, run := startControlRun(t, "control-quit")
+		pause := ask(sess, pauseCommand)
+		waitQueued(t, sess, 1)
+		stopped := serveInBackground(sess, run, 0)
+		answer(t, pause)
+		expectState(t, sess, statePaused)
+		if reply := answer(t, ask(sess, quitCommand)); reply.err != nil {
+			t.Errorf("ERROR: expected the quit answered, got %v", reply.err)
+		}
+		if !<-stopped {
+			t.Error("ERROR: expected a quit to stop a paused run")
+		}
+	})
+
+	t.Run("too many requests", func(t *testing.T) {
+		sess, run := startControlRun(t, "control-full")
+		var counts []<-chan commandReply
+		for i := 0; i < maxQueuedCommands; i++ {
+			counts = append(counts, ask(sess, countCommand))
+		}
+		waitQueued(t, sess, maxQueuedCommands)
+		reply := sess.request(countCommand, "")
+		if reply.err == nil || !strings.Contains(reply.err.Error(), "too many requests") {
+			t.Errorf("ERROR: expected a request beyond the queue to be turned down, got %v", reply.err)
+		}
+		sess.serve(run, 0)
+		for _, count := range counts {
+			if reply := answer(t, count); reply.err != nil {
+				t.Errorf("ERROR: expected the queued counts answered, got %v", reply.err)
+			}
+		}
+	})
+
+	t.Run("ended", func(t *testing.T) {
+		sess, run := startControlRun(t, "control-ended")
+		stepRun(t, run, 2)
+		// a request queued as the run ends is answered by the session
+		count := ask(sess, countCommand)
+		waitQueued(t, sess, 1)
+		sess.end(2, run.aliveCount())
+		if reply := answer(t, count); reply.turn != 2 || reply.alive != run.aliveCount() {
+			t.Errorf("ERROR: expected %v alive cells at turn 2 once the run ended, got %+v", run.aliveCount(), reply)
+		}
+		expectState(t, sess, stateIdle)
+
+		if reply := sess.request(countCommand, ""); reply.turn != 2 || reply.alive != run.aliveCount() {
+			t.Errorf("ERROR: expected the count from the end of the run, got %+v", reply)
+		}
+		if reply := sess.request(snapshotCommand, ""); reply.err == nil {
+			t.Error("ERROR: expected a snapshot with no run in progress to be turned down")
+		}
+	})
+}
+
+// TestPendingControl tests that a pause or cancel made before a run starts is kept for that
+// run, and only that run.
+func TestPendingControl(t *testing.T) {
+	t.Run("stray pause", func(t *testing.T) {
+		sess := newControlSession("pending-stray")
+		if reply := sess.request(pauseCommand, ""); reply.err == nil {
+			t.Error("ERROR: expected a pause for no run in particular to be turned down while idle")
+		}
+		expectState(t, sess, stateIdle)
+		if reply := sess.request(pauseCommand, "pending-stray-1"); reply.err != nil {
+			t.Fatal(reply.err)
+		}
+		run := beginControlRun(t, sess, "pending-stray-2")
+		expectState(t, sess, stateRunning)
+		if sess.serve(run, 1) {
+			t.Error("ERROR: expected the next run to carry on")
+		}
+	})
+
+	t.Run("pause before start", func(t *testing.T) {
+		sess := newControlSession("pending-pause")
+		sess.request(pauseCommand, "pending-pause-1")
+		run := beginControlRun(t, sess, "pending-pause-1")
+		expectState(t, sess, statePaused)
+		stopped := serveInBackground(sess, run, 1)
+		answer(t, ask(sess, unpauseCommand))
+		if <-stopped {
+			t.Error("ERROR: expected an unpaused run to carry on")
+		}
+		expectState(t, sess, stateRunning)
+	})
+
+	t.Run("cancel before start", func(t *testing.T) {
+		sess := newControlSession("pending-cancel")
+		sess.request(quitCommand, "pending-cancel-1")
+		run := beginControlRun(t, sess, "pending-cancel-1")
+		if !sess.serve(run, 1) {
+			t.Error("ERROR: expected a run cancelled before it started to stop on its first turn")
+		}
+	})
+
+	t.Run("cancel for another run", func(t *testing.T) {
+		sess := newControlSession("pending-other")
+		sess.request(quitCommand, "pending-other-1")
+		run := beginControlRun(t, sess, "pending-other-2")
+		expectState(t, sess, stateRunning)
+		if sess.serve(run, 1) {
+			t.Error("ERROR: expected a cancel for another run to leave this one going")
+		}
+	})
+}
+
+// TestCancelBeforeStart tests that a run whose controller cancelled it before the broker
+// started it stops after its first turn.
+func TestCancelBeforeStart(t *testing.T) {
+	if err := new(Server).CancelRun(stubs.SessionRequest{Session: "cancel-early", Run: "cancel-early-1"}, new(stubs.EmptyRes)); err != nil {
+		t.Fatal(err)
+	}
+	req := stubs.Request{
+		OldWorld:    randomBoard(16, 16, 5),
+		Turns:       1000000000,
+		ImageWidth:  16,
+		ImageHeight: 16,
+		Session:     "cancel-early",
+		Stream:      "cancel-early-1",
+	}
+	res := new(stubs.Response)
+	done := make(chan error, 1)
+	go func() { done <- new(Server).ProcessTurns(req, res) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ERROR: a run cancelled before it started carried on")
+	}
+	if res.Turns != 1 {
+		t.Errorf("ERROR: expected the run to stop after its first turn, it stopped at %v", res.Turns)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// flipsBuffer is how many turns of diffs may wait for the controller before the run stops
+// to let it catch up.
+const flipsBuffer = 64
+
+// flipsPoll is how long GetFlips waits for a diff before returning empty-handed.
+const flipsPoll = 500 * time.Millisecond
+
+// flipsTimeout is how long a run waits for a controller that has stopped reading diffs
+// before it gives up on the stream and carries on without it.
+var flipsTimeout = 10 * time.Second
+
+// flipsGrace is how long the diffs of a finished run stay readable before its stream is
+// dropped, in case its controller never comes back for them.
+var flipsGrace = time.Minute
+
+// flipStream queues one run's per-turn diffs for its controller.
+type flipStream struct {
+	diffs chan stubs.TurnDiff
+	// abandoned is only touched by the run sending the diffs.
+	abandoned bool
+}
+
+// active reports whether the run should still compute diffs for the stream.
+func (s *flipStream) active() bool {
+	return s != nil && !s.abandoned
+}
+
+// send queues a diff, waiting while the buffer is full so the run never gets far ahead of
+// the controller. It reports false once the controller has stopped reading.
+func (s *flipStream) send(diff stubs.TurnDiff) bool {
+	if !s.active() {
+		return false
+	}
+	select {
+	case s.diffs <- diff:
+		return true
+	case <-time.After(flipsTimeout):
+		s.abandoned = true
+		return false
+	}
+}
+
+// StreamContainer holds the flip stream of every run that asked for one.
+type StreamContainer struct {
+	mu      sync.Mutex
+	streams map[string]*flipStream
+	// opened is closed and replaced whenever a stream opens, waking everyone waiting for one.
+	opened chan struct{}
+}
+
+var streams = StreamContainer{streams: make(map[string]*flipStream), opened: make(chan struct{})}
+
+func (c *StreamContainer) open(id string) *flipStream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stream := &flipStream{diffs: make(chan stubs.TurnDiff, flipsBuffer)}
+	c.streams[id] = stream
+	close(c.opened)
+	c.opened = make(chan struct{})
+	return stream
+}
+
+// wait returns the stream called id, giving its run up to timeout to open it.
+// A controller usually asks for diffs before its run has started.
+func (c *StreamContainer) wait(id string, timeout time.Duration) *flipStream {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		stream, opened := c.streams[id], c.opened
+		c.mu.Unlock()
+
+		if stream != nil {
+			return stream
+		}
+		select {
+		case <-opened:
+		case <-deadline:
+			return nil
+		}
+	}
+}
+
+// close ends a run's stream. Diffs still queued stay readable for flipsGrace unless nobody
+// is reading them. The stream goes as soon as GetFlips reports it done.
+func (c *StreamContainer) close(id string, stream *flipStream) {
+	close(stream.diffs)
+	if stream.abandoned {
+		c.remove(id, stream)
+		return
+	}
+	time.AfterFunc(flipsGrace, func() { c.remove(id, stream) })
+}
+
+func (c *StreamContainer) remove(id string, stream *flipStream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.streams[id] == stream {
+		delete(c.streams, id)
+	}
+}
+
+// GetFlips returns the diffs queued on a stream, waiting up to flipsPoll for the first one.
+func (s *Server) GetFlips(req stubs.FlipsRequest, res *stubs.FlipsResponse) error {
+	stream := streams.wait(req.Stream, flipsPoll)
+	if stream == nil {
+		return nil
+	}
+	res.Known = true
+
+	// take returns false once the run has finished and the stream is drained
+	take := func(diff stubs.TurnDiff, ok bool) bool {
+		if !ok {
+			res.Done = true
+			streams.remove(req.Stream, stream)
+			return false
+		}
+		res.Diffs = append(res.Diffs, diff)
+		return true
+	}
+
+	select {
+	case diff, ok := <-stream.diffs:
+		if !take(diff, ok) {
+			return nil
+		}
+	case <-time.After(flipsPoll):
+		return nil
+	}
+	// after the first diff, only take what is already queued
+	for len(res.Diffs) < flipsBuffer {
+		select {
+		case diff, ok := <-stream.diffs:
+			if !take(diff, ok) {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// useFlipsTimes sets flipsTimeout and flipsGrace for the rest of the test.
+func useFlipsTimes(t *testing.T, timeout, grace time.Duration) {
+	previousTimeout, previousGrace := flipsTimeout, flipsGrace
+	flipsTimeout, flipsGrace = timeout, grace
+	t.Cleanup(func() { flipsTimeout, flipsGrace = previousTimeout, previousGrace })
+}
+
+func streamKnown(id string) bool {
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	_, ok := streams.streams[id]
+	return ok
+}
+
+func getFlips(t *testing.T, id string) *stubs.FlipsResponse {
+	t.Helper()
+	res := new(stubs.FlipsResponse)
+	if err := new(Server).GetFlips(stubs.FlipsRequest{Stream: id}, res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func diffTurns(diffs []stubs.TurnDiff) []int {
+	turns := []int{}
+	for _, diff := range diffs {
+		turns = append(turns, diff.Turn)
+	}
+	return turns
+}
+
+// TestGetFlips tests that GetFlips hands over a stream's diffs in order and reports it done once
+// its run has finished and every diff has been read, and that streams nobody reads are dropped.
+func TestGetFlips(t *testing.T) {
+	useFlipsTimes(t, 50*time.Millisecond, 100*time.Millisecond)
+
+	t.Run("unknown", func(t *testing.T) {
+		res := getFlips(t, "flips-unknown")
+		if res.Known || res.Done || len(res.Diffs) != 0 {
+			t.Errorf("ERROR: expected nothing from a stream that was never opened, got %+v", res)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		stream := streams.open("flips-read")
+		for turn := 1; turn <= 3; turn++ {
+			stream.send(stubs.TurnDiff{Turn: turn})
+		}
+		res := getFlips(t, "flips-read")
+		if !res.Known || res.Done || !reflect.DeepEqual(diffTurns(res.Diffs), []int{1, 2, 3}) {
+			t.Errorf("ERROR: expected turns 1 to 3 of a running stream, got %+v", res)
+		}
+
+		stream.send(stubs.TurnDiff{Turn: 4})
+		streams.close("flips-read", stream)
+		res = getFlips(t, "flips-read")
+		if !res.Known || !res.Done || !reflect.DeepEqual(diffTurns(res.Diffs), []int{4}) {
+			t.Errorf("ERROR: expected the last turn of a finished stream and done, got %+v", res)
+		}
+		if streamKnown("flips-read") {
+			t.Error("ERROR: expected a stream to be dropped once reported done")
+		}
+	})
+
+	t.Run("unread", func(t *testing.T) {
+		stream := streams.open("flips-unread")
+		stream.send(stubs.TurnDiff{Turn: 1})
+		streams.close("flips-unread", stream)
+		if !streamKnown("flips-unread") {
+			t.Fatal("ERROR: expected a finished stream's diffs to stay readable")
+		}
+		time.Sleep(4 * flipsGrace)
+		if streamKnown("flips-unread") {
+			t.Error("ERROR: expected a finished stream nobody read to be dropped after the grace period")
+		}
+	})
+
+	t.Run("abandoned", func(t *testing.T) {
+		stream := streams.open("flips-abandoned")
+		for turn := 1; turn <= flipsBuffer; turn++ {
+			if !stream.send(stubs.TurnDiff{Turn: turn}) {
+				t.Fatalf("ERROR: expected turn %v to fit in the buffer", turn)
+			}
+		}
+		if stream.send(stubs.TurnDiff{Turn: flipsBuffer + 1}) || stream.active() {
+			t.Error("ERROR: expected a stream nobody reads to be given up on once its buffer is full")
+		}
+		streams.close("flips-abandoned", stream)
+		if streamKnown("flips-abandoned") {
+			t.Error("ERROR: expected an abandoned stream to be dropped as soon as its run finished")
+		}
+	})
+}
+
+// TestStreamFlips tests that a controller running on the broker is sent each turn's flipped
+// cells followed by TurnComplete, and that they bring its board to the broker's.
+func TestStreamFlips(t *testing.T) {
+	p := gol.Params{
+		Turns:       20,
+		ImageWidth:  16,
+		ImageHeight: 16,
+		Mode:        gol.Distributed,
+		Server:      startBroker(t),
+		Input:       "../images/16x16.pgm",
+		OutDir:      t.TempDir(),
+	}
+	world := make([][]uint8, 16)
+	for y := range world {
+		world[y] = make([]uint8, 16)
+	}
+	flip := func(cell util.Cell) {
+		world[cell.Y][cell.X] = 255 - world[cell.Y][cell.X]
+	}
+
+	events := make(chan gol.Event)
+	result := make(chan error, 1)
+	go func() { result <- gol.Run(p, events, nil) }()
+	var initial [][]uint8
+	turn := 0
+	flipped := false
+	for event := range events {
+		// the initial board is complete once the first turn's events arrive
+		if _, ok := event.(gol.CellFlipped); !ok && initial == nil {
+			initial = make([][]uint8, len(world))
+			for y := range world {
+				initial[y] = append([]uint8(nil), world[y]...)
+			}
+		}
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			if e.CompletedTurns != 0 {
+				t.Errorf("ERROR: expected single cell flips only for the initial board, got one at turn %v", e.CompletedTurns)
+			}
+			flip(e.Cell)
+		case gol.CellsFlipped:
+			if e.CompletedTurns != turn+1 || flipped {
+				t.Errorf("ERROR: expected cells flipped once for turn %v, got them for turn %v", turn+1, e.CompletedTurns)
+			}
+			flipped = true
+			for _, cell := range e.Cells {
+				flip(cell)
+			}
+		case gol.TurnComplete:
+			if e.CompletedTurns != turn+1 {
+				t.Errorf("ERROR: expected turn %v to complete next, got %v", turn+1, e.CompletedTurns)
+			}
+			turn = e.CompletedTurns
+			flipped = false
+			if !reflect.DeepEqual(world, reference(initial, turn, engine.Conway, engine.Torus)) {
+				t.Errorf("ERROR: the board shown after turn %v differs from the broker's", turn)
+			}
+		}
+	}
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if turn != p.Turns {
+		t.Errorf("ERROR: expected %v turns to complete, got %v", p.Turns, turn)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// heartbeatTimeout is how long a registered worker may stay silent before it is dropped.
+const heartbeatTimeout = 6 * time.Second
+
+// deadCooldown is how long a static worker that failed a call is left out before it is tried again.
+const deadCooldown = 30 * time.Second
+
+type member struct {
+	lastSeen  time.Time
+	static    bool
+	deadUntil time.Time
+}
+
+// Membership is the broker's table of workers it can hand strips to.
+// Static members come from the command line and never expire; registered members must keep sending heartbeats.
+type Membership struct {
+	mu      sync.Mutex
+	members map[string]*member
+}
+
+func newMembership(static []string) *Membership {
+	m := &Membership{members: make(map[string]*member)}
+	for _, address := range static {
+		m.members[address] = &member{static: true}
+	}
+	return m
+}
+
+func (m *Membership) register(address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.members[address]; ok {
+		existing.lastSeen = time.Now()
+		existing.deadUntil = time.Time{}
+		return
+	}
+	m.members[address] = &member{lastSeen: time.Now()}
+	log.Println("worker registered:", address)
+}
+
+// heartbeat refreshes a worker and reports whether the broker still knows about it.
+func (m *Membership) heartbeat(address string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.members[address]
+	if !ok {
+		return false
+	}
+	existing.lastSeen = time.Now()
+	return true
+}
+
+func (m *Membership) deregister(address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[address]; ok {
+		delete(m.members, address)
+		log.Println("worker deregistered:", address)
+	}
+}
+
+// markDead takes a worker that failed a call out of rotation. A registered worker is forgotten
+// (it re-registers on its next heartbeat if it is still alive); a static one sits out for deadCooldown.
+func (m *Membership) markDead(address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.members[address]
+	if !ok {
+		return
+	}
+	if existing.static {
+		existing.deadUntil = time.Now().Add(deadCooldown)
+	} else {
+		delete(m.members, address)
+	}
+	log.Println("worker marked dead:", address)
+}
+
+// healthy returns the addresses of live workers in a stable order, at most limit of them (0 means no limit).
+func (m *Membership) healthy(limit int) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	addresses := make([]string, 0, len(m.members))
+	for address, worker := range m.members {
+		if !worker.static && time.Since(worker.lastSeen) > heartbeatTimeout {
+			delete(m.members, address)
+			log.Println("worker timed out:", address)
+			continue
+		}
+		if time.Now().Before(worker.deadUntil) {
+			continue
+		}
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	if limit > 0 && len(addresses) > limit {
+		addresses = addresses[:limit]
+	}
+	return addresses
+}
+
+func (s *Server) RegisterWorker(req stubs.WorkerInfo, _ *stubs.EmptyRes) error {
+	if err := validateAddress(req.Address); err != nil {
+		return err
+	}
+	members.register(req.Address)
+	return nil
+}
+
+func (s *Server) Heartbeat(req stubs.WorkerInfo, res *stubs.HeartbeatResponse) error {
+	res.Known = members.heartbeat(req.Address)
+	return nil
+}
+
+func (s *Server) DeregisterWorker(req stubs.WorkerInfo, _ *stubs.EmptyRes) error {
+	members.deregister(req.Address)
+	return nil
+}
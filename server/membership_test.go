@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// useMembers swaps in a fresh membership table for the rest of the test.
+func useMembers(t *testing.T, static ...string) *Membership {
+	previous := members
+	members = newMembership(static)
+	t.Cleanup(func() { members = previous })
+	return members
+}
+
+// TestMembership tests that workers come and go from the healthy list as they register,
+// send heartbeats, fall silent, deregister and fail calls.
+func TestMembership(t *testing.T) {
+	m := useMembers(t, "10.0.0.3:8040")
+	server := &Server{}
+
+	for _, address := range []string{"10.0.0.2:8040", "10.0.0.1:8040"} {
+		if err := server.RegisterWorker(stubs.WorkerInfo{Address: address}, &stubs.EmptyRes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := server.RegisterWorker(stubs.WorkerInfo{Address: "no-port"}, &stubs.EmptyRes{}); err == nil {
+		t.Error("ERROR: expected a worker address without a port to be turned down")
+	}
+	expectHealthy := func(limit int, expected ...string) {
+		t.Helper()
+		healthy := m.healthy(limit)
+		if len(healthy) != len(expected) || len(expected) > 0 && !reflect.DeepEqual(healthy, expected) {
+			t.Errorf("ERROR: expected healthy workers %v, got %v", expected, healthy)
+		}
+	}
+	expectHealthy(0, "10.0.0.1:8040", "10.0.0.2:8040", "10.0.0.3:8040")
+	expectHealthy(2, "10.0.0.1:8040", "10.0.0.2:8040")
+
+	heartbeat := func(address string) bool {
+		res := stubs.HeartbeatResponse{}
+		if err := server.Heartbeat(stubs.WorkerInfo{Address: address}, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res.Known
+	}
+	if !heartbeat("10.0.0.1:8040") || heartbeat("10.0.0.9:8040") {
+		t.Error("ERROR: expected heartbeats to be known only from registered workers")
+	}
+
+	// a registered worker that falls silent is dropped, but a static one never expires
+	m.mu.Lock()
+	m.members["10.0.0.2:8040"].lastSeen = time.Now().Add(-2 * heartbeatTimeout)
+	m.members["10.0.0.3:8040"].lastSeen = time.Now().Add(-2 * heartbeatTimeout)
+	m.mu.Unlock()
+	expectHealthy(0, "10.0.0.1:8040", "10.0.0.3:8040")
+	if heartbeat("10.0.0.2:8040") {
+		t.Error("ERROR: expected a timed out worker to be told to register again")
+	}
+
+	// a failed static worker sits out its cooldown, a failed registered one is forgotten
+	m.markDead("10.0.0.3:8040")
+	m.markDead("10.0.0.1:8040")
+	expectHealthy(0)
+	m.mu.Lock()
+	m.members["10.0.0.3:8040"].deadUntil = time.Now().Add(-time.Second)
+	m.mu.Unlock()
+	expectHealthy(0, "10.0.0.3:8040")
+
+	// registering again brings a static worker straight back from its cooldown
+	m.markDead("10.0.0.3:8040")
+	m.register("10.0.0.3:8040")
+	expectHealthy(0, "10.0.0.3:8040")
+
+	if err := server.DeregisterWorker(stubs.WorkerInfo{Address: "10.0.0.3:8040"}, &stubs.EmptyRes{}); err != nil {
+		t.Fatal(err)
+	}
+	expectHealthy(0)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/node"
+)
+
+// localAddress stands in for a worker address when the broker has to compute strips itself.
+const localAddress = "local"
+
+// workerTimeout bounds every call to a worker; a worker that takes longer is treated as failed.
+var workerTimeout = 10 * time.Second
+
+// dialWorker opens a connection to a worker. Tests swap it for workers inside the test process.
+var dialWorker = func(address string) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, workerTimeout)
+}
+
+// localNode serves the strip RPCs inside the broker process.
+var localNode = rpc.NewServer()
+
+func init() {
+	if err := localNode.RegisterName("Node", node.NewStore()); err != nil {
+		panic(err)
+	}
+}
+
+// workerPool keeps one RPC connection open per worker for the lifetime of a run,
+// so turns no longer pay for a TCP handshake per worker.
+type workerPool struct {
+	mu      sync.Mutex
+	clients map[string]*rpc.Client
+}
+
+func newWorkerPool() *workerPool {
+	return &workerPool{clients: make(map[string]*rpc.Client)}
+}
+
+func (p *workerPool) get(address string) (*rpc.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client, ok := p.clients[address]; ok {
+		return client, nil
+	}
+	var client *rpc.Client
+	if address == localAddress {
+		serverConn, clientConn := net.Pipe()
+		go localNode.ServeConn(serverConn)
+		client = rpc.NewClient(clientConn)
+	} else {
+		conn, err := dialWorker(address)
+		if err != nil {
+			return nil, err
+		}
+		client = rpc.NewClient(conn)
+	}
+	p.clients[address] = client
+	return client, nil
+}
+
+// drop forgets a broken connection so the next call dials again.
+func (p *workerPool) drop(address string, client *rpc.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.clients[address] == client {
+		delete(p.clients, address)
+		client.Close()
+	}
+}
+
+// call runs an RPC on a worker, reconnecting once if the pooled connection has gone stale.
+// Errors returned by the worker itself are passed straight back without a retry, and a worker
+// that does not answer within workerTimeout is given up on.
+func (p *workerPool) call(address, method string, req, res interface{}) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var client *rpc.Client
+		client, err = p.get(address)
+		if err != nil {
+			return err
+		}
+		call := client.Go(method, req, res, make(chan *rpc.Call, 1))
+		select {
+		case <-call.Done:
+			err = call.Error
+		case <-time.After(workerTimeout):
+			p.drop(address, client)
+			return fmt.Errorf("%v timed out after %v", method, workerTimeout)
+		}
+		var serverErr rpc.ServerError
+		if err == nil || errors.As(err, &serverErr) {
+			return err
+		}
+		p.drop(address, client)
+	}
+	return err
+}
+
+func (p *workerPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for address, client := range p.clients {
+		client.Close()
+		delete(p.clients, address)
+	}
+}
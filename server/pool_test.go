@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// TestPool tests that the pool keeps one connection per worker, reconnects once when that
+// connection has broken, passes the worker's own errors straight back and gives up on a
+// worker that does not answer.
+func TestPool(t *testing.T) {
+	w := startTestWorker(t, "pool-test:8040")
+	pool := newWorkerPool()
+	defer pool.close()
+
+	load := stubs.WorkerRequest{Job: "pool-test", Strip: [][]uint8{{0, 255, 0}}, Width: 3, Rule: engine.Conway}
+	fetch := func() error {
+		return pool.call("pool-test:8040", stubs.FetchStrip, stubs.StripRequest{Job: "pool-test"}, new(stubs.WorkerResponse))
+	}
+	if err := pool.call("pool-test:8040", stubs.LoadStrip, load, &stubs.EmptyRes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if dials := w.dialCount(); dials != 1 {
+		t.Errorf("ERROR: expected one connection for two calls, got %v", dials)
+	}
+
+	w.disconnect()
+	if err := fetch(); err != nil {
+		t.Errorf("ERROR: expected the call to reconnect after the connection broke, got %v", err)
+	}
+	if dials := w.dialCount(); dials != 2 {
+		t.Errorf("ERROR: expected one reconnection, got %v connections", dials)
+	}
+
+	err := pool.call("pool-test:8040", stubs.FetchStrip, stubs.StripRequest{Job: "unknown"}, new(stubs.WorkerResponse))
+	var serverErr rpc.ServerError
+	if !errors.As(err, &serverErr) {
+		t.Errorf("ERROR: expected the worker's own error, got %v", err)
+	}
+	if dials := w.dialCount(); dials != 2 {
+		t.Errorf("ERROR: expected the worker's own error not to be retried, got %v connections", dials)
+	}
+
+	if err := pool.call("pool-test:8041", stubs.FetchStrip, stubs.StripRequest{Job: "pool-test"}, new(stubs.WorkerResponse)); err == nil {
+		t.Error("ERROR: expected a call to a missing worker to fail")
+	}
+
+	previous := workerTimeout
+	workerTimeout = 100 * time.Millisecond
+	defer func() { workerTimeout = previous }()
+	stall := make(chan struct{})
+	defer close(stall)
+	w.mu.Lock()
+	w.stall = stall
+	w.mu.Unlock()
+	err = pool.call("pool-test:8040", stubs.StepStrip, stubs.HaloRequest{Job: "pool-test", Top: make([]uint8, 3), Bottom: make([]uint8, 3)}, new(stubs.HaloResponse))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("ERROR: expected a stalled worker to time out, got %v", err)
+	}
+}
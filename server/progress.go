@@ -0,0 +1,154 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// progressDiffs is how many turns of diffs are kept for subscribers that ask for them.
+const progressDiffs = 256
+
+// subscribePoll is how long Subscribe waits for news, beyond the subscriber's Every, before
+// replying with nothing new.
+const subscribePoll = 5 * time.Second
+
+// diffInterest is how long after a subscriber last asked for diffs the run keeps computing them.
+const diffInterest = 10 * time.Second
+
+// progressHub publishes a session's turns to its subscribers, so the run never waits on them.
+type progressHub struct {
+	mu     sync.Mutex
+	latest stubs.Progress
+	// diffs holds the latest turns' diffs, with the Version each was published at.
+	diffs    []stubs.TurnDiff
+	versions []int
+	// changed is closed and replaced whenever there is news, waking every subscriber.
+	changed chan struct{}
+	// diffsUntil is when the last subscriber asking for diffs stops being waited for.
+	diffsUntil time.Time
+}
+
+// publish records news, waking the subscribers. It is called with h.mu held.
+func (h *progressHub) publish() {
+	h.latest.Version++
+	if h.changed != nil {
+		close(h.changed)
+	}
+	h.changed = make(chan struct{})
+}
+
+// start publishes a run beginning at turn with alive cells.
+func (h *progressHub) start(turn, alive int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latest.Running = true
+	h.latest.Turn, h.latest.Alive = turn, alive
+	h.diffs, h.versions = nil, nil
+	h.publish()
+}
+
+// turn publishes a completed turn, keeping its diff if a subscriber wants diffs. diffed says
+// whether the run worked the diff out: a subscriber may have asked for diffs while the turn
+// was being computed without one, and that turn is left out rather than kept empty.
+func (h *progressHub) turn(alive int, diff stubs.TurnDiff, diffed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latest.Turn, h.latest.Alive = diff.Turn, alive
+	h.publish()
+	if diffed && time.Now().Before(h.diffsUntil) {
+		if len(h.diffs) == progressDiffs {
+			h.diffs, h.versions = h.diffs[1:], h.versions[1:]
+		}
+		h.diffs = append(h.diffs, diff)
+		h.versions = append(h.versions, h.latest.Version)
+	}
+}
+
+// finish publishes the end of the run at turn with alive cells.
+func (h *progressHub) finish(turn, alive int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latest.Running = false
+	h.latest.Turn, h.latest.Alive = turn, alive
+	h.publish()
+}
+
+// wantsDiffs reports whether a subscriber has asked for diffs recently enough for the run to compute them.
+func (h *progressHub) wantsDiffs() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return time.Now().Before(h.diffsUntil)
+}
+
+// news returns the latest progress and the channel closed when it changes.
+func (h *progressHub) news(req stubs.SubscribeRequest) (stubs.Progress, <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.changed == nil {
+		h.changed = make(chan struct{})
+	}
+	progress := h.latest
+	if req.Diffs {
+		for i, version := range h.versions {
+			if version > req.After {
+				progress.Diffs = append(progress.Diffs, h.diffs[i])
+			}
+		}
+	}
+	return progress, h.changed
+}
+
+// wait answers a subscriber once there is news after req.After and req.Every has passed,
+// or with the progress as it stands once subscribePoll has passed as well.
+func (h *progressHub) wait(req stubs.SubscribeRequest) stubs.Progress {
+	if req.Diffs {
+		h.mu.Lock()
+		if until := time.Now().Add(req.Every + diffInterest); until.After(h.diffsUntil) {
+			h.diffsUntil = until
+		}
+		h.mu.Unlock()
+	}
+	earliest := time.After(req.Every)
+	giveUp := time.After(req.Every + subscribePoll)
+	for {
+		progress, changed := h.news(req)
+		if progress.Version > req.After {
+			if earliest == nil {
+				return progress
+			}
+			select {
+			case <-earliest:
+				// news that came in meanwhile goes out too
+				progress, _ = h.news(req)
+				return progress
+			case <-giveUp:
+				return progress
+			}
+		}
+		select {
+		case <-changed:
+		case <-earliest:
+			earliest = nil
+		case <-giveUp:
+			return progress
+		}
+	}
+}
+
+// Subscribe is a long poll for a session's progress, answered at most once every req.Every.
+// Unlike GetAliveCells, it never holds up the run.
+func (s *Server) Subscribe(req stubs.SubscribeRequest, res *stubs.Progress) error {
+	sess, err := sessions.get(req.Session)
+	if err != nil {
+		return err
+	}
+	*res = sess.progress.wait(req)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+func subscribe(t *testing.T, req stubs.SubscribeRequest) (stubs.Progress, time.Duration) {
+	t.Helper()
+	start := time.Now()
+	var progress stubs.Progress
+	if err := new(Server).Subscribe(req, &progress); err != nil {
+		t.Fatal(err)
+	}
+	return progress, time.Since(start)
+}
+
+// TestSubscribe tests that Subscribe reports a running session's progress once it has moved on
+// from the subscriber's last Version, no sooner than Every, with the diffs of the turns since,
+// and the end of the run.
+func TestSubscribe(t *testing.T) {
+	const session = "subscribe"
+	world := randomBoard(64, 64, 6)
+	req := stubs.Request{
+		OldWorld:    world,
+		Turns:       1000000000,
+		ImageWidth:  64,
+		ImageHeight: 64,
+		Session:     session,
+	}
+	res := new(stubs.Response)
+	done := make(chan error, 1)
+	go func() { done <- new(Server).ProcessTurns(req, res) }()
+
+	// the first reply comes as soon as there is any news
+	first, _ := subscribe(t, stubs.SubscribeRequest{Session: session, Diffs: true})
+	for !first.Running {
+		first, _ = subscribe(t, stubs.SubscribeRequest{Session: session, After: first.Version, Diffs: true})
+	}
+	// the turn being computed when diffs were first asked for may have gone without, but every
+	// turn after the next reply has its diff
+	first, _ = subscribe(t, stubs.SubscribeRequest{Session: session, After: first.Version, Diffs: true})
+
+	every := 200 * time.Millisecond
+	next, waited := subscribe(t, stubs.SubscribeRequest{Session: session, After: first.Version, Every: every, Diffs: true})
+	if waited < every {
+		t.Errorf("ERROR: expected no reply before %v, got one after %v", every, waited)
+	}
+	if next.Version <= first.Version || next.Turn <= first.Turn || !next.Running {
+		t.Errorf("ERROR: expected progress past version %v at turn %v, got %+v", first.Version, first.Turn, next)
+	}
+	// the diffs are those of the turns since the first reply, or of as many of the latest as are kept,
+	// and bring the board to the latest turn
+	if len(next.Diffs) == 0 || next.Diffs[len(next.Diffs)-1].Turn != next.Turn ||
+		next.Diffs[0].Turn != first.Turn+1 && len(next.Diffs) != progressDiffs {
+		t.Fatalf("ERROR: expected the diffs of turns %v to %v, or the last %v of them", first.Turn+1, next.Turn, progressDiffs)
+	}
+	from := next.Diffs[0].Turn - 1
+	for i, diff := range next.Diffs {
+		if diff.Turn != from+1+i {
+			t.Fatalf("ERROR: expected the diff of turn %v, got turn %v", from+1+i, diff.Turn)
+		}
+	}
+	board := reference(world, from, engine.Conway, engine.Torus)
+	for _, diff := range next.Diffs {
+		for i, cell := range diff.Cells {
+			board[cell.Y][cell.X] = diff.Levels[i]
+		}
+	}
+	expected := reference(world, next.Turn, engine.Conway, engine.Torus)
+	if !reflect.DeepEqual(board, expected) || next.Alive != engine.CountAlive(expected) {
+		t.Errorf("ERROR: expected the diffs to bring the board to turn %v, with %v alive cells", next.Turn, next.Alive)
+	}
+
+	if err := new(Server).CancelRun(stubs.SessionRequest{Session: session}, new(stubs.EmptyRes)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	last, _ := subscribe(t, stubs.SubscribeRequest{Session: session, After: next.Version})
+	if last.Running || last.Turn != res.Turns || last.Alive != engine.CountAlive(res.NewWorld) {
+		t.Errorf("ERROR: expected the run to end at turn %v with %v alive cells, got %+v", res.Turns, engine.CountAlive(res.NewWorld), last)
+	}
+}
@@ -1,180 +1,34 @@
 package main
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/rpc"
-	"sync"
+	"uk.ac.bris.cs/gameoflife/engine"
 	"uk.ac.bris.cs/gameoflife/stubs"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
 var distWorkerNum int
+var members *Membership
 
 var quitting = make(chan bool, 1)
 
 type RestartInfo struct {
 	restart bool
 	turns   int
+	width   int
+	height  int
 	world   [][]uint8
 }
 
-type BoolContainer struct {
-	mu     sync.Mutex
-	status bool
-}
-
-type IntContainer2 struct {
-	mu    sync.Mutex
-	value int
-	turn  int
-}
-
-type IntContainer struct {
-	mu   sync.Mutex
-	turn int
-}
-
-type WorldContainer struct {
-	mu    sync.Mutex
-	world [][]uint8
-	turn  int
-}
-
-type LargeWorldContainer struct {
-	mu     sync.Mutex
-	worlds [][][]uint8
-}
-
-func (c *LargeWorldContainer) setAtIndex(i int, w [][]uint8) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.worlds[i] = w
-}
-
-func (c *LargeWorldContainer) getAtIndex(i int) [][]uint8 {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	return c.worlds[i]
-}
-
-func (c *LargeWorldContainer) setup(u [][][]uint8) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.worlds = u
-}
-
-func (c *BoolContainer) get() bool {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	return c.status
-}
-
-func (c *BoolContainer) setTrue() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.status = true
-}
-
-func (c *BoolContainer) setFalse() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.status = false
-}
-
-func (c *IntContainer2) getTurn() int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	return c.turn
-}
-
-func (c *IntContainer) get() int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	return c.turn
-}
-
-func (c *IntContainer) set(val int) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.turn = val
-}
-
-func (c *IntContainer2) getCount() int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	return c.value
-}
-
-func (w *WorldContainer) getWorld() [][]uint8 {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	return w.world
-}
-func (w *WorldContainer) getTurn() int {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	return w.turn
-}
-
-func (w *WorldContainer) set(new [][]uint8, turn int) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	w.world = new
-	w.turn = turn
-}
-
-func (w *WorldContainer) setWorld(new [][]uint8) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	w.world = new
-}
-
-func (w *WorldContainer) setTurn(new int) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	w.turn = new
-}
-
-func (c *IntContainer2) set(turnsCompleted, count int) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.value = count
-	c.turn = turnsCompleted
-}
-
-var pausedTurn IntContainer
-var getCount, paused, snapShot, quit, shut, clientQuit BoolContainer
-var aliveCount IntContainer2
-var waitingSnapShot, pause, waitingForCount, waitingPause, waitingShut, makingSnapshot, working sync.WaitGroup
-var world, snapshotInfo WorldContainer
-var restartInformation RestartInfo
-var splitWorld LargeWorldContainer
-
 func getAliveCells(height, width int, world [][]uint8) []util.Cell {
 	aliveCells := make([]util.Cell, 0)
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			if world[x][y] == 255 {
+			if world[y][x] == 255 {
 				aliveCells = append(aliveCells, util.Cell{X: x, Y: y})
 			}
 		}
@@ -182,231 +36,273 @@ func getAliveCells(height, width int, world [][]uint8) []util.Cell {
 	return aliveCells
 }
 
-func getAliveCellsFor(world [][]uint8, height, width int) int {
-	count := 0
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			if world[x][y] == 255 {
-				count++
-			}
-		}
-	}
-	return count
-}
-
 type Server struct{}
 
-func (s *Server) GetAliveCells(_ stubs.RequestAlive, res *stubs.ResponseAlive) error {
-	getCount.setTrue()
-	waitingForCount.Add(1)
-	waitingForCount.Wait()
-	res.NumAlive = aliveCount.getCount()
-	res.Turn = aliveCount.getTurn()
-	return nil
+func (s *Server) GetAliveCells(req stubs.SessionRequest, res *stubs.ResponseAlive) error {
+	sess, err := sessions.get(req.Session)
+	if err != nil {
+		return err
+	}
+	// with no run in progress, the count from the end of the last run stands
+	reply := sess.request(countCommand, req.Run)
+	res.NumAlive = reply.alive
+	res.Turn = reply.turn
+	return reply.err
 }
 
-func (s *Server) GetSnapshot(_ stubs.RequestAlive, res *stubs.ResponseSnapshot) error {
-	// we want to get back the state of the board
-	snapShot.setTrue()
-	waitingSnapShot.Add(1)
-	waitingSnapShot.Wait()
-	res.Turns = snapshotInfo.getTurn()
-	res.NewWorld = snapshotInfo.getWorld()
-	return nil
+func (s *Server) GetSnapshot(req stubs.SessionRequest, res *stubs.ResponseSnapshot) error {
+	sess, err := sessions.get(req.Session)
+	if err != nil {
+		return err
+	}
+	reply := sess.request(snapshotCommand, req.Run)
+	res.NewWorld = reply.world
+	res.Turns = reply.turn
+	return reply.err
 }
 
-func (s *Server) GetSnapshotPaused(_ stubs.RequestAlive, res *stubs.ResponseSnapshot) error {
-	// we want to get back the state of the board
-	makingSnapshot.Add(1)
-	res.NewWorld = world.getWorld()
-	res.Turns = world.turn
-	makingSnapshot.Done()
-	return nil
+// GetSnapshotPaused is GetSnapshot for a paused session, which is answered straight away.
+func (s *Server) GetSnapshotPaused(req stubs.SessionRequest, res *stubs.ResponseSnapshot) error {
+	return s.GetSnapshot(req, res)
 }
 
-func (s *Server) PauseProcessing(_ stubs.EmptyReq, res *stubs.ResponseTurn) error {
-	// pause the processing
-	//waitingPause.Add(1)
-	pause.Add(1)
-	paused.setTrue()
-	//waitingPause.Wait()
-	res.Turn = pausedTurn.get()
-	return nil
-}
-func (s *Server) Quit(_ stubs.EmptyReq, _ *stubs.EmptyRes) error {
-	// quit once next turn is complete
-	quit.setTrue()
-	return nil
+func (s *Server) PauseProcessing(req stubs.SessionRequest, res *stubs.ResponseTurn) error {
+	sess, err := sessions.get(req.Session)
+	if err != nil {
+		return err
+	}
+	reply := sess.request(pauseCommand, req.Run)
+	res.Turn = reply.turn
+	return reply.err
 }
 
-func (s *Server) ClientQuit(_ stubs.EmptyReq, _ *stubs.EmptyRes) error {
-	clientQuit.setTrue()
+// Quit stops the broker once the next turn is complete. It ends every session, not just the caller's.
+func (s *Server) Quit(_ stubs.SessionRequest, _ *stubs.EmptyRes) error {
+	stop()
 	return nil
 }
 
-func (s *Server) ClientQuitPause(_ stubs.EmptyReq, _ *stubs.EmptyRes) error {
-	clientQuit.setTrue()
-	pause.Done()
-	return nil
+func (s *Server) ClientQuit(req stubs.SessionRequest, _ *stubs.EmptyRes) error {
+	sess, err := sessions.get(req.Session)
+	if err != nil {
+		return err
+	}
+	return sess.request(quitCommand, req.Run).err
 }
 
-func (s *Server) UnpauseProcessing(_ stubs.EmptyReq, _ *stubs.EmptyRes) error {
-	paused.setFalse()
-	pause.Done()
-	return nil
-}
-func (s *Server) ShutDistribute() error {
-	shut.setTrue()
-	waitingShut.Add(1)
-	waitingShut.Wait()
-	return nil
+// ClientQuitPause is ClientQuit for a paused session.
+func (s *Server) ClientQuitPause(req stubs.SessionRequest, res *stubs.EmptyRes) error {
+	return s.ClientQuit(req, res)
 }
 
-func makeNewWorld(height, width int) [][]uint8 {
-	newWorld := make([][]uint8, height)
-	for i := range newWorld {
-		newWorld[i] = make([]uint8, width)
+// CancelRun ends the session's run for a controller that has given up on it. The run stops
+// after its current turn, paused or not, and is kept to restart from like any other. A run
+// cancelled before the broker has started it stops after its first turn.
+func (s *Server) CancelRun(req stubs.SessionRequest, _ *stubs.EmptyRes) error {
+	sess, err := sessions.get(req.Session)
+	if err != nil {
+		return err
 	}
-	return newWorld
+	if sess.busy() {
+		log.Printf("controller of session %v cancelled its run\n", sess.id)
+	}
+	return sess.request(quitCommand, req.Run).err
 }
 
-func runWorker(client *rpc.Client, size, start, end int, currentWorld [][]uint8, splitSegment chan [][]uint8) {
-	res := new(stubs.WorkerResponse)
-	req := stubs.WorkerRequest{
-		WholeWorld: currentWorld,
-		Start:      start,
-		End:        end,
-		Size:       size,
-	}
-	if err := client.Call(stubs.CalculateWorldSegment, req, res); err != nil {
-		fmt.Println(err)
+func (s *Server) UnpauseProcessing(req stubs.SessionRequest, _ *stubs.EmptyRes) error {
+	sess, err := sessions.get(req.Session)
+	if err != nil {
+		return err
 	}
-	splitSegment <- res.Segment
+	return sess.request(unpauseCommand, req.Run).err
 }
 
-func setupWorkers(workers []*rpc.Client, size, workerNum int, currentWorld [][]uint8, splitSegments []chan [][]uint8) {
-	numRows := size / workerNum
-
-	i := 0
-	for i < workerNum-1 {
-		go runWorker(workers[i], size, i*numRows, numRows*(i+1), currentWorld, splitSegments[i])
-		i++
+// healthyWorkers lists the workers to use for a board, never more than it has rows.
+// With no healthy workers left the broker computes the board itself.
+func healthyWorkers(height int) []string {
+	addresses := members.healthy(distWorkerNum)
+	if len(addresses) == 0 {
+		return []string{localAddress}
 	}
-
-	// final worker does the remaining rows
-	go runWorker(workers[i], size, i*numRows, size, currentWorld, splitSegments[i])
+	if len(addresses) > height {
+		addresses = addresses[:height]
+	}
+	return addresses
 }
 
-func closeWorkers(workers []*rpc.Client) {
-	req := new(stubs.WorkerRequest)
-	res := new(stubs.WorkerResponse)
-	for _, worker := range workers {
-		if err := worker.Call(stubs.End, req, &res); err != nil {
-			fmt.Println(err)
+func sameAddresses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
-		worker.Close()
 	}
+	return true
 }
 
-func calculateNextWorld(currentWorld [][]uint8, size, workerNum int) [][]uint8 {
-	var newWorld [][]uint8
-	splitSegments := make([]chan [][]uint8, workerNum)
-	for i := range splitSegments {
-		splitSegments[i] = make(chan [][]uint8)
+// remember keeps the board as the point the session's next restart resumes from, in memory and on disk.
+func (sess *session) remember(world [][]uint8, turn, width, height int) {
+	sess.restartInformation = RestartInfo{restart: true, turns: turn, width: width, height: height, world: world}
+	err := sess.checkpoints.save(Checkpoint{Turn: turn, Width: width, Height: height, World: world})
+	if err != nil {
+		log.Println(err)
 	}
+}
 
-
-	workerPorts := [8]string{"172.31.80.251:8040", "172.31.95.36:8050", "172.31.95.121:8060","172.31.84.109:8070","172.31.95.40:8080"}
-	workers := make([]*rpc.Client, workerNum)
-
-	for i := 0; i < workerNum; i++ {
-		worker, err := rpc.Dial("tcp", workerPorts[i])
-		if err != nil {
-			fmt.Print("Error connecting to worker: ")
-			fmt.Println(err)
-		}
-		workers[i] = worker
+// restartPoint returns where the session's restart resumes from, reading its checkpoint
+// from disk if the broker has not run the session since it started.
+func (sess *session) restartPoint() (RestartInfo, error) {
+	if sess.restartInformation.restart {
+		return sess.restartInformation, nil
 	}
-
-	setupWorkers(workers, size, workerNum, currentWorld, splitSegments)
-	// no wait group needed as channel waits for worker to finish
-	for i := 0; i < workerNum; i++ {
-		newWorld = append(newWorld, <-splitSegments[i]...)
+	checkpoint, found, err := sess.checkpoints.load()
+	if err != nil || !found {
+		return RestartInfo{}, err
 	}
-
-	//closeWorkers(workers)
-	return newWorld
+	log.Printf("loaded checkpoint of session %v: a %vx%v board at turn %v\n",
+		sess.id, checkpoint.Width, checkpoint.Height, checkpoint.Turn)
+	return RestartInfo{
+		restart: true,
+		turns:   checkpoint.Turn,
+		width:   checkpoint.Width,
+		height:  checkpoint.Height,
+		world:   checkpoint.World,
+	}, nil
 }
 
 func (s *Server) ProcessTurns(req stubs.Request, res *stubs.Response) error {
+	sess, err := sessions.get(req.Session)
+	if err != nil {
+		return err
+	}
+	// a restarting controller takes over from a run whose controller has gone away
+	if req.Restart && sess.busy() {
+		sess.request(quitCommand, "")
+	}
+	sess.runLock.Lock()
+	defer sess.runLock.Unlock()
+	sessions.start(sess)
+	defer sessions.finish(sess)
+
 	currentWorld := req.OldWorld
-	nextWorld := makeNewWorld(req.ImageHeight, req.ImageWidth)
 	turn := 0
+	pool := newWorkerPool()
+	defer pool.close()
 	if req.Restart {
-		if restartInformation.restart {
-			currentWorld = restartInformation.world
-			turn = restartInformation.turns
-		} else {
-			return errors.New("nothing to restart with")
+		restartInformation, err := sess.restartPoint()
+		if err != nil {
+			return err
 		}
+		if !restartInformation.restart {
+			return fmt.Errorf("nothing to restart session %v with", sess.id)
+		}
+		if restartInformation.width != req.ImageWidth || restartInformation.height != req.ImageHeight {
+			return fmt.Errorf("cannot restart a %vx%v board from a %vx%v checkpoint",
+				req.ImageWidth, req.ImageHeight, restartInformation.width, restartInformation.height)
+		}
+		currentWorld = restartInformation.world
+		turn = restartInformation.turns
+		log.Printf("resuming session %v from turn %v\n", sess.id, turn)
 	}
 
-	for turnNum := 0; turnNum < req.Turns; turnNum++ {
-		// 매 턴마다 nextWorld를 새롭게 계산
-		nextWorld = calculateNextWorld(currentWorld, req.ImageWidth, 5)
-
-		// 결과를 응답 구조체에 설정
-		//res.AliveCell = getNumAliveCells(req.ImageHeight, req.ImageWidth, nextWorld)
-		turn = turnNum + 1
-
-		// 다음 턴을 위해 world 교체
-		currentWorld = nextWorld
-		world.set(currentWorld, turn)
-
-		makingSnapshot.Wait()
+	run, err := newStripRun(pool, currentWorld, turn, req.ImageWidth, req.ImageHeight, req.Rule.OrDefault(), req.Topology, req.Packed, healthyWorkers(req.ImageHeight))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		sess.end(turn, run.aliveCount())
+		run.release()
+	}()
+	sess.begin(turn, run.aliveCount(), req.Stream)
+	sess.checkpoints.reset(turn)
+
+	var stream *flipStream
+	if req.Stream != "" {
+		stream = streams.open(req.Stream)
+		defer streams.close(req.Stream, stream)
+		if req.Restart && len(req.OldWorld) == req.ImageHeight {
+			// the controller is showing its input image, not the board being resumed
+			cells, levels := engine.Diff(req.OldWorld, currentWorld, 0)
+			stream.send(stubs.TurnDiff{Turn: turn, Cells: cells, Levels: levels})
+		}
+	}
 
-		if paused.get() {
-			pausedTurn.set(turn)
-			//waitingPause.Done()
-			pause.Wait()
+	for turn < req.Turns {
+		// workers joined or left: gather the board and partition it across the new set
+		if healthy := healthyWorkers(req.ImageHeight); !sameAddresses(healthy, run.addresses()) {
+			if err := run.rebalance(healthy); err != nil {
+				return err
+			}
 		}
-		if quit.get() {
-			break
+
+		diffed := stream.active() || sess.progress.wantsDiffs()
+		diff, err := run.step(diffed)
+		if err != nil {
+			return err
 		}
-		if snapShot.get() {
-			snapShot.setFalse()
-			snapshotInfo.set(currentWorld, turn)
-			waitingSnapShot.Done()
+		turn++
+		sess.progress.turn(run.aliveCount(), diff, diffed)
+		if stream.active() && !stream.send(diff) {
+			log.Printf("controller of session %v stopped reading turn diffs, carrying on without them\n", sess.id)
 		}
-		if getCount.get() {
-			getCount.setFalse()
-			aliveCount.set(turn, getAliveCellsFor(currentWorld, req.ImageHeight, req.ImageWidth))
-			waitingForCount.Done()
+
+		if sess.checkpoints.due(turn) {
+			checkpointWorld, checkpointTurn, err := run.fetch()
+			if err != nil {
+				return err
+			}
+			sess.remember(checkpointWorld, checkpointTurn, req.ImageWidth, req.ImageHeight)
 		}
-		if clientQuit.get() {
-			restartInformation = RestartInfo{restart: true, turns: turn, world: currentWorld}
-			clientQuit.setFalse()
+
+		if sess.serve(run, turn) || stopRequested() {
 			break
 		}
 	}
 
+	currentWorld, _, err = run.fetch()
+	if err != nil {
+		return err
+	}
+	sess.remember(currentWorld, turn, req.ImageWidth, req.ImageHeight)
 	res.Turns = turn
 	res.NewWorld = currentWorld
 	res.AliveCellLocation = getAliveCells(req.ImageHeight, req.ImageWidth, currentWorld)
 
-	if quit.get() {
-		quitting <- true
+	if stopRequested() {
+		// every session that sees the quit gets here, but the broker only needs telling once
+		select {
+		case quitting <- true:
+		default:
+		}
 	}
 	return nil
 }
 
 func main() {
 	serverPort := flag.String("port", "8030", "Port to Listen")
-	workers := flag.Int("workerNum", 2, "Workers to use")
+	workers := flag.Int("workerNum", 0, "Maximum number of workers to use (0 uses every healthy worker)")
+	workerList := flag.String("workers", "", "Comma-separated worker addresses (host:port)")
+	configPath := flag.String("config", "", "File listing one worker address per line")
+	flag.DurationVar(&workerTimeout, "workerTimeout", workerTimeout, "How long to wait for a worker before treating it as failed")
+	flag.IntVar(&syncEvery, "syncEvery", syncEvery, "Turns between copies of the board kept for recovering from worker failures")
+	flag.StringVar(&checkpoints.path, "checkpoint", "", "Directory to checkpoint running boards to and resume them from, one file per session")
+	flag.IntVar(&checkpoints.turns, "checkpointTurns", 0, "Write a checkpoint every N turns (0 disables)")
+	flag.DurationVar(&checkpoints.interval, "checkpointInterval", 0, "Write a checkpoint at least this often (0 disables)")
 	flag.Parse()
 
 	distWorkerNum = *workers
 
+	addresses, err := loadWorkerAddresses(*workerList, *configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, probeErr := range probeWorkers(addresses) {
+		log.Println("warning:", probeErr)
+	}
+	members = newMembership(addresses)
+
 	rpc.Register(&Server{})
 	listener, err := net.Listen("tcp", "0.0.0.0:"+*serverPort)
 	if err != nil {
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultSession is used for requests from controllers that do not name a session.
+const defaultSession = "default"
+
+// maxIdleSessions is how many sessions without a run in progress are kept in memory. Beyond that
+// the least recently used are forgotten; a checkpoint on disk still lets them restart.
+const maxIdleSessions = 64
+
+// session is the state of one controller's run. Sessions are independent, so several
+// controllers can share the broker and its workers.
+type session struct {
+	id string
+
+	// runLock lets only one run use the session at a time.
+	runLock sync.Mutex
+
+	// control guards active, state, pending, turn and alive. While active, the run's loop takes
+	// the requests queued on commands; otherwise they are answered from the session's fields.
+	control sync.Mutex
+	active  bool
+	state   runState
+	// pending is the stream of the run that a pause or cancel made while idle is kept for.
+	pending  string
+	turn     int
+	alive    int
+	commands chan command
+
+	// progress publishes the session's turns to its subscribers.
+	progress progressHub
+
+	// restartInformation and checkpoints are only touched while holding runLock.
+	restartInformation RestartInfo
+	checkpoints        checkpointer
+
+	// running and lastUsed are guarded by the SessionContainer.
+	running  bool
+	lastUsed time.Time
+}
+
+// SessionContainer holds every session the broker knows about.
+type SessionContainer struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+var sessions = SessionContainer{sessions: make(map[string]*session)}
+
+// validSession reports whether id can name a session. Session IDs become checkpoint file
+// names, so they are kept to letters, digits, '-' and '_'.
+func validSession(id string) bool {
+	if len(id) > 64 {
+		return false
+	}
+	for _, ch := range id {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '-', ch == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the session called id, creating it if the broker has not seen it before.
+// Controllers may ask about a session just before their run starts, so that is not an error.
+func (c *SessionContainer) get(id string) (*session, error) {
+	if id == "" {
+		id = defaultSession
+	}
+	if !validSession(id) {
+		return nil, fmt.Errorf("invalid session %q: use letters, digits, '-' and '_'", id)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.sessions[id]
+	if ok {
+		s.lastUsed = time.Now()
+		return s, nil
+	}
+	s = &session{
+		id:          id,
+		checkpoints: checkpoints.forSession(id),
+		commands:    make(chan command, maxQueuedCommands),
+		lastUsed:    time.Now(),
+	}
+	c.sessions[id] = s
+	c.evict()
+	return s, nil
+}
+
+// start marks a session as running so it is never evicted mid-run.
+func (c *SessionContainer) start(s *session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.running = true
+	s.lastUsed = time.Now()
+}
+
+// finish marks a session as idle again once its run has returned.
+func (c *SessionContainer) finish(s *session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.running = false
+	s.lastUsed = time.Now()
+}
+
+// evict forgets the least recently used idle sessions beyond maxIdleSessions.
+// It is called with c.mu held.
+func (c *SessionContainer) evict() {
+	for {
+		idle := 0
+		var oldest *session
+		for _, s := range c.sessions {
+			if s.running {
+				continue
+			}
+			idle++
+			if oldest == nil || s.lastUsed.Before(oldest.lastUsed) {
+				oldest = s
+			}
+		}
+		if idle <= maxIdleSessions {
+			return
+		}
+		delete(c.sessions, oldest.id)
+	}
+}
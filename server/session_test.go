@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// readImage reads a P5 image.
+func readImage(t *testing.T, path string) [][]uint8 {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var magic string
+	var width, height, maxval int
+	if _, err := fmt.Fscan(r, &magic, &width, &height, &maxval); err != nil || magic != "P5" {
+		t.Fatalf("%v is not a pgm file: %v", path, err)
+	}
+	// a single whitespace character separates the header from the cells
+	if _, err := r.ReadByte(); err != nil {
+		t.Fatal(err)
+	}
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = make([]uint8, width)
+		if _, err := io.ReadFull(r, world[y]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return world
+}
+
+func aliveCells(world [][]uint8) []util.Cell {
+	cells := []util.Cell{}
+	for y, row := range world {
+		for x, cell := range row {
+			if cell == 255 {
+				cells = append(cells, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	return cells
+}
+
+// runOnBroker runs p on the broker, returning the final alive cells and the first turn it
+// was sent TurnComplete for.
+func runOnBroker(t *testing.T, p gol.Params) ([]util.Cell, int) {
+	events := make(chan gol.Event)
+	result := make(chan error, 1)
+	go func() { result <- gol.Run(p, events, nil) }()
+	var cells []util.Cell
+	first := -1
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		case gol.TurnComplete:
+			if first < 0 {
+				first = e.CompletedTurns
+			}
+		}
+	}
+	if err := <-result; err != nil {
+		t.Errorf("ERROR: session %v failed: %v", p.Session, err)
+	}
+	return cells, first
+}
+
+// TestSessions tests that two controllers sharing the broker, each in its own session, run
+// side by side without disturbing each other's boards, alive counts or restart points, and
+// that a restart picks up its own session's run.
+func TestSessions(t *testing.T) {
+	address := startBroker(t)
+	tests := []struct {
+		session string
+		size    int
+		turns   int
+	}{
+		{"sessions-a", 16, 50},
+		{"sessions-b", 64, 100},
+	}
+	params := func(session string, size, turns int) gol.Params {
+		return gol.Params{
+			Turns:       turns,
+			ImageWidth:  size,
+			ImageHeight: size,
+			Mode:        gol.Distributed,
+			Server:      address,
+			Session:     session,
+			Input:       fmt.Sprintf("../images/%vx%v.pgm", size, size),
+			OutDir:      t.TempDir(),
+		}
+	}
+	// check checks the session's board, alive count and restart point against the reference after turns
+	check := func(session string, size, turns int, cells []util.Cell) {
+		t.Helper()
+		expected := reference(readImage(t, fmt.Sprintf("../images/%vx%v.pgm", size, size)), turns, engine.Conway, engine.Torus)
+		if !reflect.DeepEqual(cells, aliveCells(expected)) {
+			t.Errorf("ERROR: session %v did not finish on the board %v turns on", session, turns)
+		}
+
+		res := new(stubs.ResponseAlive)
+		if err := new(Server).GetAliveCells(stubs.SessionRequest{Session: session}, res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Turn != turns || res.NumAlive != engine.CountAlive(expected) {
+			t.Errorf("ERROR: expected session %v to count %v alive cells at turn %v, got %v at turn %v",
+				session, engine.CountAlive(expected), turns, res.NumAlive, res.Turn)
+		}
+
+		sess, err := sessions.get(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.runLock.Lock()
+		restart := sess.restartInformation
+		sess.runLock.Unlock()
+		if !restart.restart || restart.turns != turns || restart.width != size || restart.height != size ||
+			!reflect.DeepEqual(restart.world, expected) {
+			t.Errorf("ERROR: expected session %v to restart from turn %v of its own board, got turn %v of a %vx%v board",
+				session, turns, restart.turns, restart.width, restart.height)
+		}
+	}
+
+	results := make([][]util.Cell, len(tests))
+	var wg sync.WaitGroup
+	for i, test := range tests {
+		wg.Add(1)
+		go func(i int, p gol.Params) {
+			defer wg.Done()
+			results[i], _ = runOnBroker(t, p)
+		}(i, params(test.session, test.size, test.turns))
+	}
+	wg.Wait()
+	for i, test := range tests {
+		check(test.session, test.size, test.turns, results[i])
+	}
+
+	// restarting the first session carries on from its own restart point, leaving the second's alone
+	p := params("sessions-a", 16, 80)
+	p.Restart = true
+	cells, first := runOnBroker(t, p)
+	if first != 50 {
+		t.Errorf("ERROR: expected the restart to resume at turn 50, it started at %v", first)
+	}
+	check("sessions-a", 16, 80, cells)
+	check("sessions-b", 64, 100, results[1])
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+// maxRecoveries bounds how many times one operation is retried after workers fail.
+const maxRecoveries = 5
+
+// syncEvery is how many turns may pass before the broker pulls a fresh copy of the board,
+// which is the point a run rolls back to when a worker dies.
+var syncEvery = 100
+
+var jobCounter int64
+
+func newJobID() string {
+	return fmt.Sprintf("%x-%d", time.Now().UnixNano(), atomic.AddInt64(&jobCounter, 1))
+}
+
+// workerError records which worker a failed strip call went to.
+type workerError struct {
+	address string
+	err     error
+}
+
+func (e *workerError) Error() string {
+	return fmt.Sprintf("worker %v: %v", e.address, e.err)
+}
+
+// workerErrors collects every strip call that failed during one operation.
+type workerErrors []*workerError
+
+func (errs workerErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// workerStrip is the broker's view of one worker's strip: where it sits in the board and its
+// current boundary rows, as packedTop and packedBottom in a packed run. The cells in between
+// only live on the worker. still is set while the strip did not change on its last turn.
+type workerStrip struct {
+	address      string
+	start, end   int
+	top          []uint8
+	bottom       []uint8
+	packedTop    []uint64
+	packedBottom []uint64
+	alive        int
+	still        bool
+}
+
+// eachStrip runs f on every strip concurrently and reports every strip that failed.
+func eachStrip(strips []*workerStrip, f func(i int, s *workerStrip) error) error {
+	errs := make([]error, len(strips))
+	var wg sync.WaitGroup
+	for i, s := range strips {
+		wg.Add(1)
+		go func(i int, s *workerStrip) {
+			defer wg.Done()
+			errs[i] = f(i, s)
+		}(i, s)
+	}
+	wg.Wait()
+	var failed workerErrors
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, &workerError{address: strips[i].address, err: err})
+		}
+	}
+	if failed != nil {
+		return failed
+	}
+	return nil
+}
+
+// releaseStrips tells the workers they can forget a job's strips.
+func releaseStrips(pool *workerPool, job string, strips []*workerStrip) {
+	_ = eachStrip(strips, func(_ int, s *workerStrip) error {
+		return pool.call(s.address, stubs.ReleaseStrip, stubs.StripRequest{Job: job}, &stubs.EmptyRes{})
+	})
+}
+
+// stripRun is one partitioning of the board across workers. Each turn only the boundary rows
+// travel over the network; the full board is fetched only when somebody needs it.
+//
+// Strips that would come out of a turn as they went in are not stepped at all: see idle.
+//
+// A packed run keeps the strips bit-packed on the workers and sends packed rows between them,
+// so the board is only turned back into bytes when it is fetched.
+//
+// If a worker fails, the run reloads the last synced board onto the workers that are still
+// healthy (or onto the broker itself) and replays the lost turns, so callers never see a gap.
+type stripRun struct {
+	// mu keeps fetches from seeing a board halfway through a turn.
+	mu         sync.Mutex
+	turn       int
+	job        string
+	pool       *workerPool
+	width      int
+	height     int
+	rule       engine.Rule
+	topology   engine.Topology
+	packed     bool
+	strips     []*workerStrip
+	synced     [][]uint8
+	syncedTurn int
+}
+
+// newStripRun splits world into one strip of rows per worker and loads each strip onto its worker.
+// With packed set the strips are bit-packed, which needs a two-state rule.
+func newStripRun(pool *workerPool, world [][]uint8, turn, width, height int, rule engine.Rule, topology engine.Topology, packed bool, addresses []string) (*stripRun, error) {
+	if packed {
+		if err := engine.PackedSupports(rule); err != nil {
+			return nil, err
+		}
+	}
+	r := &stripRun{turn: turn, pool: pool, width: width, height: height, rule: rule, topology: topology, packed: packed}
+	err := r.retry(func() error { return r.load(world, turn, addresses) })
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load partitions world across addresses under a fresh job ID.
+func (r *stripRun) load(world [][]uint8, turn int, addresses []string) error {
+	workerNum := len(addresses)
+	if workerNum > r.height {
+		workerNum = r.height
+	}
+	r.job = newJobID()
+	r.turn = turn
+	r.synced = world
+	r.syncedTurn = turn
+	r.strips = nil
+
+	numRows := r.height / workerNum
+	for i := 0; i < workerNum; i++ {
+		start, end := i*numRows, (i+1)*numRows
+		// final worker does the remaining rows
+		if i == workerNum-1 {
+			end = r.height
+		}
+		s := &workerStrip{
+			address: addresses[i],
+			start:   start,
+			end:     end,
+			top:     world[start],
+			bottom:  world[end-1],
+			alive:   engine.CountAlive(world[start:end]),
+		}
+		if r.packed {
+			s.packedTop = engine.PackRow(s.top)
+			s.packedBottom = engine.PackRow(s.bottom)
+		}
+		r.strips = append(r.strips, s)
+	}
+
+	return eachStrip(r.strips, func(_ int, s *workerStrip) error {
+		req := stubs.WorkerRequest{
+			Job:      r.job,
+			Start:    s.start,
+			End:      s.end,
+			Width:    r.width,
+			Rule:     r.rule,
+			Topology: r.topology,
+		}
+		if r.packed {
+			req.Packed = engine.Pack(world[s.start:s.end])
+		} else {
+			req.Strip = world[s.start:s.end]
+		}
+		return r.pool.call(s.address, stubs.LoadStrip, req, &stubs.EmptyRes{})
+	})
+}
+
+// retry runs op, recovering from failed workers and trying again a bounded number of times.
+func (r *stripRun) retry(op func() error) error {
+	// a failed recovery can leave r.turn anywhere, so remember where the run has to get back to
+	target := r.turn
+	err := op()
+	for attempt := 0; err != nil && attempt < maxRecoveries; attempt++ {
+		err = r.recover(err, target)
+		if err == nil {
+			err = op()
+		}
+	}
+	return err
+}
+
+// recover marks the workers behind cause as dead, reloads the last synced board onto the
+// remaining workers and replays turns until the run is back at target.
+func (r *stripRun) recover(cause error, target int) error {
+	failed, ok := cause.(workerErrors)
+	if !ok {
+		return cause
+	}
+	for _, f := range failed {
+		log.Println("strip failed:", f)
+		if f.address != localAddress {
+			members.markDead(f.address)
+		}
+	}
+
+	go releaseStrips(r.pool, r.job, r.strips)
+
+	if err := r.load(r.synced, r.syncedTurn, healthyWorkers(r.height)); err != nil {
+		return err
+	}
+	log.Printf("recovered at turn %v, replaying to turn %v\n", r.syncedTurn, target)
+	for r.turn < target {
+		if _, err := r.stepOnce(false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// step advances every strip one turn. With flips set it also returns the cells that changed;
+// turns replayed after a failure are never reported, so each turn's diff is seen exactly once.
+func (r *stripRun) step(flips bool) (stubs.TurnDiff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var diff stubs.TurnDiff
+	err := r.retry(func() error {
+		var err error
+		diff, err = r.stepOnce(flips)
+		return err
+	})
+	if err != nil {
+		return diff, err
+	}
+	if r.turn-r.syncedTurn >= syncEvery {
+		return diff, r.retry(r.fetchOnce)
+	}
+	return diff, nil
+}
+
+// stepOnce steps every strip that is not idle, feeding each the boundary rows of its neighbours.
+func (r *stripRun) stepOnce(flips bool) (stubs.TurnDiff, error) {
+	requests := r.halos(flips)
+	idle := make([]bool, len(r.strips))
+	for i := range r.strips {
+		idle[i] = r.idle(i)
+	}
+	responses := make([]stubs.HaloResponse, len(r.strips))
+	err := eachStrip(r.strips, func(i int, s *workerStrip) error {
+		if idle[i] {
+			return nil
+		}
+		return r.pool.call(s.address, stubs.StepStrip, requests[i], &responses[i])
+	})
+	if err != nil {
+		return stubs.TurnDiff{}, err
+	}
+	r.turn++
+	diff := stubs.TurnDiff{Turn: r.turn}
+	for i, s := range r.strips {
+		if idle[i] {
+			continue
+		}
+		s.still = responses[i].Still
+		s.top, s.bottom = responses[i].Top, responses[i].Bottom
+		s.packedTop, s.packedBottom = responses[i].PackedTop, responses[i].PackedBottom
+		s.alive = responses[i].AliveCount
+		diff.Cells = append(diff.Cells, responses[i].Cells...)
+		diff.Levels = append(diff.Levels, responses[i].Levels...)
+	}
+	return diff, nil
+}
+
+// idle reports whether strip i can skip a turn. A still strip comes out of a turn as it went
+// in as long as its halos are as they were, which they are if the strips they come from are
+// still too. The end strips' halos come from the strips at either end, whatever the topology.
+func (r *stripRun) idle(i int) bool {
+	n := len(r.strips)
+	for _, j := range []int{i - 1, i, i + 1} {
+		if !r.strips[(j+n)%n].still {
+			return false
+		}
+	}
+	return true
+}
+
+// halos builds the request that steps each strip, carrying the boundary rows its neighbours
+// had last turn. The strips at the top and bottom of the board get whatever the topology puts
+// beyond its edges.
+func (r *stripRun) halos(flips bool) []stubs.HaloRequest {
+	n := len(r.strips)
+	requests := make([]stubs.HaloRequest, n)
+	if r.packed {
+		above, below := r.topology.BeyondPacked(r.strips[0].packedTop, r.strips[n-1].packedBottom, r.width)
+		for i := range requests {
+			requests[i] = stubs.HaloRequest{Job: r.job, PackedTop: above, PackedBottom: below, Flips: flips}
+			if i > 0 {
+				requests[i].PackedTop = r.strips[i-1].packedBottom
+			}
+			if i < n-1 {
+				requests[i].PackedBottom = r.strips[i+1].packedTop
+			}
+		}
+		return requests
+	}
+	above, below := r.topology.Beyond(r.strips[0].top, r.strips[n-1].bottom)
+	for i := range requests {
+		requests[i] = stubs.HaloRequest{Job: r.job, Top: above, Bottom: below, Flips: flips}
+		if i > 0 {
+			requests[i].Top = r.strips[i-1].bottom
+		}
+		if i < n-1 {
+			requests[i].Bottom = r.strips[i+1].top
+		}
+	}
+	return requests
+}
+
+// fetch assembles the whole board from the workers, along with the turn it belongs to.
+func (r *stripRun) fetch() ([][]uint8, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.retry(r.fetchOnce)
+	return r.synced, r.turn, err
+}
+
+// fetchOnce pulls every strip into a fresh board and makes it the new rollback point.
+func (r *stripRun) fetchOnce() error {
+	world := make([][]uint8, r.height)
+	err := eachStrip(r.strips, func(_ int, s *workerStrip) error {
+		res := new(stubs.WorkerResponse)
+		if err := r.pool.call(s.address, stubs.FetchStrip, stubs.StripRequest{Job: r.job}, res); err != nil {
+			return err
+		}
+		segment := res.Segment
+		if r.packed {
+			segment = engine.Unpack(res.Packed, r.width)
+		}
+		copy(world[s.start:s.end], segment)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.synced = world
+	r.syncedTurn = r.turn
+	return nil
+}
+
+// rebalance moves the board onto a new set of workers.
+func (r *stripRun) rebalance(addresses []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.retry(r.fetchOnce); err != nil {
+		return err
+	}
+	go releaseStrips(r.pool, r.job, r.strips)
+	return r.retry(func() error { return r.load(r.synced, r.syncedTurn, addresses) })
+}
+
+func (r *stripRun) aliveCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, s := range r.strips {
+		count += s.alive
+	}
+	return count
+}
+
+func (r *stripRun) addresses() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	addresses := make([]string, len(r.strips))
+	for i, s := range r.strips {
+		addresses[i] = s.address
+	}
+	return addresses
+}
+
+// release tells the workers they can forget this run's strips.
+func (r *stripRun) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	releaseStrips(r.pool, r.job, r.strips)
+}
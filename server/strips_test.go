@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+)
+
+// randomBoard makes a board with about a third of its cells alive.
+func randomBoard(width, height int, seed int64) [][]uint8 {
+	random := rand.New(rand.NewSource(seed))
+	world := make([][]uint8, height)
+	for y := range world {
+		world[y] = make([]uint8, width)
+		for x := range world[y] {
+			if random.Intn(3) == 0 {
+				world[y][x] = 255
+			}
+		}
+	}
+	return world
+}
+
+// reference steps the whole board turns times with engine.Step.
+func reference(world [][]uint8, turns int, rule engine.Rule, topology engine.Topology) [][]uint8 {
+	for turn := 0; turn < turns; turn++ {
+		above, below := topology.Beyond(world[0], world[len(world)-1])
+		world = engine.Step(world, above, below, len(world[0]), rule, topology)
+	}
+	return world
+}
+
+// useSyncEvery sets syncEvery for the rest of the test.
+func useSyncEvery(t *testing.T, turns int) {
+	previous := syncEvery
+	syncEvery = turns
+	t.Cleanup(func() { syncEvery = previous })
+}
+
+// stepRun steps run turns times, failing the test on the first error.
+func stepRun(t *testing.T, run *stripRun, turns int) {
+	t.Helper()
+	for turn := 0; turn < turns; turn++ {
+		if _, err := run.step(false); err != nil {
+			t.Fatalf("turn %v: %v", run.turn, err)
+		}
+	}
+}
+
+// checkRun fails the test unless run holds the board world comes to after turns.
+func checkRun(t *testing.T, run *stripRun, world [][]uint8, turns int, rule engine.Rule, topology engine.Topology) {
+	t.Helper()
+	got, turn, err := run.fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if turn != turns {
+		t.Errorf("ERROR: expected the run to be at turn %v, got %v", turns, turn)
+	}
+	if !reflect.DeepEqual(got, reference(world, turns, rule, topology)) {
+		t.Errorf("ERROR: the board after %v turns differs from engine.Step on the whole board", turns)
+	}
+}
+
+// TestRecovery tests that a run whose worker fails mid-run rolls back to the last synced
+// board, replays the lost turns on the workers left and still comes to the right board.
+func TestRecovery(t *testing.T) {
+	useMembers(t, "recovery-a:8040", "recovery-b:8040")
+	useSyncEvery(t, 10)
+	a := startTestWorker(t, "recovery-a:8040")
+	b := startTestWorker(t, "recovery-b:8040")
+	b.failAt = 25
+
+	world := randomBoard(40, 30, 1)
+	pool := newWorkerPool()
+	defer pool.close()
+	run, err := newStripRun(pool, world, 0, 40, 30, engine.Conway, engine.Torus, false, healthyWorkers(30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer run.release()
+	if addresses := run.addresses(); !reflect.DeepEqual(addresses, []string{"recovery-a:8040", "recovery-b:8040"}) {
+		t.Fatalf("ERROR: expected the run to use both workers, got %v", addresses)
+	}
+
+	stepRun(t, run, 60)
+	checkRun(t, run, world, 60, engine.Conway, engine.Torus)
+	if addresses := run.addresses(); !reflect.DeepEqual(addresses, []string{"recovery-a:8040"}) {
+		t.Errorf("ERROR: expected the run to carry on without the failed worker, got %v", addresses)
+	}
+	a.mu.Lock()
+	steps := a.steps
+	a.mu.Unlock()
+	if steps <= 60 {
+		t.Errorf("ERROR: expected the worker left to replay the turns since the last sync, but it stepped %v times in 60 turns", steps)
+	}
+}
+
+// TestRebalance tests that strips passing halos between workers come to the same board as
+// engine.Step on the whole board on every topology, while workers join and leave mid-run.
+func TestRebalance(t *testing.T) {
+	for _, topology := range []engine.Topology{engine.Torus, engine.Dead, engine.Reflect, engine.Klein} {
+		t.Run(topology.String(), func(t *testing.T) {
+			m := useMembers(t, "rebalance-a:8040", "rebalance-b:8040")
+			for _, address := range []string{"rebalance-a:8040", "rebalance-b:8040", "rebalance-c:8040"} {
+				startTestWorker(t, address)
+			}
+			world := randomBoard(37, 23, 2)
+			pool := newWorkerPool()
+			defer pool.close()
+			run, err := newStripRun(pool, world, 0, 37, 23, engine.Conway, topology, false, healthyWorkers(23))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer run.release()
+
+			rebalance := func(expected ...string) {
+				t.Helper()
+				if err := run.rebalance(healthyWorkers(23)); err != nil {
+					t.Fatal(err)
+				}
+				if addresses := run.addresses(); !reflect.DeepEqual(addresses, expected) {
+					t.Fatalf("ERROR: expected the run to move onto %v, got %v", expected, addresses)
+				}
+			}
+			stepRun(t, run, 15)
+			m.register("rebalance-c:8040")
+			rebalance("rebalance-a:8040", "rebalance-b:8040", "rebalance-c:8040")
+			stepRun(t, run, 15)
+			m.deregister("rebalance-b:8040")
+			rebalance("rebalance-a:8040", "rebalance-c:8040")
+			stepRun(t, run, 15)
+			checkRun(t, run, world, 45, engine.Conway, topology)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/node"
+	"uk.ac.bris.cs/gameoflife/stubs"
+)
+
+func TestMain(m *testing.M) {
+	dialWorker = dialTestWorker
+	members = newMembership(nil)
+	os.Exit(m.Run())
+}
+
+// testWorker is a worker inside the test process. The broker reaches it over net.Pipe through
+// dialWorker, as it does its own localNode.
+type testWorker struct {
+	store *node.Store
+
+	mu    sync.Mutex
+	dials int
+	conns []net.Conn
+	// steps counts StepStrip calls. Once failAt of them have been made, with failAt above
+	// zero, the worker fails that call and every call after it.
+	steps  int
+	failAt int
+	failed bool
+	// stall, while set, holds every StepStrip call until it is closed.
+	stall chan struct{}
+}
+
+var testWorkers = struct {
+	sync.Mutex
+	byAddress map[string]*testWorker
+}{byAddress: make(map[string]*testWorker)}
+
+// startTestWorker makes a worker reachable at address until the test ends.
+func startTestWorker(t *testing.T, address string) *testWorker {
+	w := &testWorker{store: node.NewStore()}
+	testWorkers.Lock()
+	testWorkers.byAddress[address] = w
+	testWorkers.Unlock()
+	t.Cleanup(func() {
+		testWorkers.Lock()
+		delete(testWorkers.byAddress, address)
+		testWorkers.Unlock()
+		w.disconnect()
+	})
+	return w
+}
+
+func dialTestWorker(address string) (net.Conn, error) {
+	testWorkers.Lock()
+	w, ok := testWorkers.byAddress[address]
+	testWorkers.Unlock()
+	if !ok {
+		return nil, errors.New("dial " + address + ": connection refused")
+	}
+
+	serverConn, clientConn := net.Pipe()
+	server := rpc.NewServer()
+	if err := server.RegisterName("Node", &testNode{w}); err != nil {
+		return nil, err
+	}
+	go server.ServeConn(serverConn)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dials++
+	w.conns = append(w.conns, serverConn)
+	return clientConn, nil
+}
+
+// disconnect breaks every connection to the worker, as if the network had dropped them.
+func (w *testWorker) disconnect() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, conn := range w.conns {
+		conn.Close()
+	}
+	w.conns = nil
+}
+
+func (w *testWorker) dialCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.dials
+}
+
+func (w *testWorker) check() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.failed {
+		return errors.New("worker failed")
+	}
+	return nil
+}
+
+// step counts a StepStrip call, failing it if the worker is due to fail.
+func (w *testWorker) step() error {
+	w.mu.Lock()
+	w.steps++
+	if w.failAt > 0 && w.steps >= w.failAt {
+		w.failed = true
+	}
+	failed, stall := w.failed, w.stall
+	w.mu.Unlock()
+
+	if stall != nil {
+		<-stall
+	}
+	if failed {
+		return errors.New("worker failed")
+	}
+	return nil
+}
+
+// testNode serves a testWorker's strip RPCs.
+type testNode struct {
+	w *testWorker
+}
+
+func (n *testNode) LoadStrip(req stubs.WorkerRequest, res *stubs.EmptyRes) error {
+	if err := n.w.check(); err != nil {
+		return err
+	}
+	return n.w.store.LoadStrip(req, res)
+}
+
+func (n *testNode) StepStrip(req stubs.HaloRequest, res *stubs.HaloResponse) error {
+	if err := n.w.step(); err != nil {
+		return err
+	}
+	return n.w.store.StepStrip(req, res)
+}
+
+func (n *testNode) FetchStrip(req stubs.StripRequest, res *stubs.WorkerResponse) error {
+	if err := n.w.check(); err != nil {
+		return err
+	}
+	return n.w.store.FetchStrip(req, res)
+}
+
+func (n *testNode) ReleaseStrip(req stubs.StripRequest, res *stubs.EmptyRes) error {
+	return n.w.store.ReleaseStrip(req, res)
+}
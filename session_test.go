@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestRestartNeedsSession tests that a restart without a session to resume is turned down.
+func TestRestartNeedsSession(t *testing.T) {
+	p := gol.Params{Turns: 10, Threads: 4, ImageWidth: 16, ImageHeight: 16, Restart: true}
+	_, failures, err := runImage(p)
+	if err == nil || len(failures) != 1 || failures[0].Operation != "params" {
+		t.Errorf("ERROR: expected the restart to be turned down, got %v and %v", err, failures)
+	}
+}
@@ -1,15 +1,63 @@
 package stubs
 
-var CalculateWorldSegment = "Node.GetSegment"
+import (
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+var LoadStrip = "Node.LoadStrip"
+var StepStrip = "Node.StepStrip"
+var FetchStrip = "Node.FetchStrip"
+var ReleaseStrip = "Node.ReleaseStrip"
 var End = "Node.Quit"
 
+// WorkerRequest hands a worker the rows it owns for the rest of a run.
+// Job identifies the run so one worker can serve several at once.
+// A strip sent as Packed rows, with Strip left empty, is kept and stepped packed for the whole run.
 type WorkerRequest struct {
-	WholeWorld [][]uint8
-	Start      int
-	End        int
-	Size       int
+	Job      string
+	Strip    [][]uint8
+	Packed   [][]uint64
+	Start    int
+	End      int
+	Width    int
+	Rule     engine.Rule
+	Topology engine.Topology
 }
 
+// WorkerResponse carries a strip in the form it was loaded in: Packed for a packed strip.
 type WorkerResponse struct {
 	Segment [][]uint8
+	Packed  [][]uint64
+}
+
+// HaloRequest advances a stored strip by one turn given the row above and the row below it.
+// Flips asks for the cells that changed as well. A packed strip takes its halos as PackedTop
+// and PackedBottom instead of Top and Bottom.
+type HaloRequest struct {
+	Job          string
+	Top          []uint8
+	Bottom       []uint8
+	PackedTop    []uint64
+	PackedBottom []uint64
+	Flips        bool
+}
+
+// HaloResponse carries the strip's new boundary rows, which become its neighbours' halos next turn.
+// Cells and Levels are only filled in when the request asked for flips. A packed strip sends
+// its boundary rows as PackedTop and PackedBottom. Still is set when no cell of the strip
+// changed, so the strip need not be stepped again until a neighbouring strip changes.
+type HaloResponse struct {
+	Top          []uint8
+	Bottom       []uint8
+	PackedTop    []uint64
+	PackedBottom []uint64
+	AliveCount   int
+	Still        bool
+	Cells        []util.Cell
+	Levels       []uint8
+}
+
+type StripRequest struct {
+	Job string
 }
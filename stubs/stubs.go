@@ -1,6 +1,11 @@
 package stubs
 
-import "uk.ac.bris.cs/gameoflife/util"
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/util"
+)
 
 var Turns = "Server.ProcessTurns"
 var Alive = "Server.GetAliveCells"
@@ -11,6 +16,12 @@ var Pause = "Server.PauseProcessing"
 var Unpause = "Server.UnpauseProcessing"
 var QuitClient = "Server.ClientQuit"
 var QuitClientPaused = "Server.ClientQuitPause"
+var RegisterWorker = "Server.RegisterWorker"
+var Heartbeat = "Server.Heartbeat"
+var DeregisterWorker = "Server.DeregisterWorker"
+var GetFlips = "Server.GetFlips"
+var Cancel = "Server.CancelRun"
+var Subscribe = "Server.Subscribe"
 
 type AliveCellsRequest struct {
 }
@@ -39,6 +50,24 @@ type Request struct {
 	Start       int
 	End         int
 	Restart     bool
+	Rule        engine.Rule
+	Topology    engine.Topology
+	// Session names the controller's run, keeping it apart from other controllers' runs.
+	// A restart resumes the session's last checkpoint. Empty is the broker's default session.
+	Session string
+	// Stream names the per-turn diffs the controller reads with GetFlips. Empty sends none.
+	// It is new for every run, so diffs left over from an earlier run in the session are never read.
+	Stream string
+	// Packed keeps the board bit-packed on the workers, 64 cells to a word. It needs a two-state rule.
+	Packed bool
+}
+
+// SessionRequest picks the session a pause, snapshot, count or quit applies to. Run is the
+// Stream of the controller's run, so that a pause or cancel sent before the broker has started
+// that run is kept for it, and for no other.
+type SessionRequest struct {
+	Session string
+	Run     string
 }
 
 type Empty struct {
@@ -65,6 +94,57 @@ type ResponseSnapshot struct {
 	Turns    int
 }
 
+type WorkerInfo struct {
+	Address string
+}
+
+type HeartbeatResponse struct {
+	Known bool
+}
+
+// TurnDiff lists the cells that changed on the way to Turn, with the grey level each changed to.
+type TurnDiff struct {
+	Turn   int
+	Cells  []util.Cell
+	Levels []uint8
+}
+
+type FlipsRequest struct {
+	Stream string
+}
+
+// FlipsResponse carries the diffs queued since the last call. Known is false while the broker
+// has no such stream, and Done is set once the run has finished and every diff has been read.
+type FlipsResponse struct {
+	Diffs []TurnDiff
+	Known bool
+	Done  bool
+}
+
+// SubscribeRequest asks for a session's progress once it has moved on from After.
+type SubscribeRequest struct {
+	Session string
+	// After is the Version of the last Progress seen, or zero for none.
+	After int
+	// Every is the least time the broker waits before replying, so a subscriber is not sent
+	// every turn. Zero replies as soon as there is news.
+	Every time.Duration
+	// Diffs asks for the diffs of the turns since After as well.
+	Diffs bool
+}
+
+// Progress is a session's run as the broker last published it. Version goes up with every
+// turn and whenever a run starts or ends.
+type Progress struct {
+	Version int
+	Running bool
+	Turn    int
+	Alive   int
+	// Diffs are the changes made since the request's After, oldest first, if they were asked
+	// for. Only the latest turns are kept, so a gap between the turns means some were missed.
+	Diffs []TurnDiff
+}
+
 type EmptyRes struct {
 }
 
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/engine"
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestTopology tests 64x64 and 128x64 images after 100 turns on each bounded topology.
+func TestTopology(t *testing.T) {
+	var tests []boardTest
+	for _, size := range [][2]int{{64, 64}, {128, 64}} {
+		for _, topology := range []engine.Topology{engine.Dead, engine.Reflect, engine.Klein} {
+			p := gol.Params{ImageWidth: size[0], ImageHeight: size[1], Turns: 100, Threads: 4, Topology: topology}
+			tests = append(tests, boardTest{name: fmt.Sprintf("%dx%dx%d-%v", p.ImageWidth, p.ImageHeight, p.Turns, topology), params: p})
+		}
+	}
+	runBoardTests(t, tests)
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"uk.ac.bris.cs/gameoflife/engine"
 	"uk.ac.bris.cs/gameoflife/gol"
 	"uk.ac.bris.cs/gameoflife/util"
 )
@@ -61,6 +62,67 @@ func assertEqualBoard(t *testing.T, given, expected []util.Cell, p gol.Params) b
 	return equal
 }
 
+// boardTest is a run of the game and the board it should finish on.
+type boardTest struct {
+	name   string
+	params gol.Params
+	// expected is the final board. Left nil, it is the check image for params: see checkImage.
+	expected []util.Cell
+	// failure is the Operation of the one ErrorOccurred a run that should be turned down stops with.
+	failure string
+	// within, if set, is how long the run may take.
+	within time.Duration
+}
+
+// checkImage reads the alive cells of the check image for a run of p on the 16x16, 64x64 or
+// 512x512 image, or on a bounded topology.
+func checkImage(p gol.Params) []util.Cell {
+	path := fmt.Sprintf("check/images/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns)
+	if p.Topology != engine.Torus {
+		path = fmt.Sprintf("check/images/topology/%vx%vx%v-%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns, p.Topology)
+	}
+	return readAliveCells(path, p.ImageWidth, p.ImageHeight)
+}
+
+// runBoardTests runs each test as a subtest, writing its images to a temporary directory.
+func runBoardTests(t *testing.T, tests []boardTest) {
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := test.params
+			if p.OutDir == "" {
+				p.OutDir = t.TempDir()
+			}
+			var err error
+			var cells []util.Cell
+			var failures []gol.ErrorOccurred
+			run := func() { cells, failures, err = runImage(p) }
+			if test.within > 0 {
+				if !timeout(t, test.within, run, "%v took more than %v", test.name, test.within) {
+					return
+				}
+			} else {
+				run()
+			}
+
+			if test.failure != "" {
+				if err == nil || len(failures) != 1 || failures[0].Operation != test.failure {
+					t.Errorf("ERROR: expected the run to be turned down, got %v and %v", err, failures)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := test.expected
+			if expected == nil {
+				expected = checkImage(p)
+			}
+			assertEqualBoard(t, cells, expected, p)
+		})
+	}
+}
+
 func emptyOutFolder() {
 	os.RemoveAll("out")
 	_ = os.Mkdir("out", os.ModePerm)